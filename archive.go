@@ -0,0 +1,150 @@
+package codec
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+)
+
+const (
+	// maxArchiveEntries limits how many entries are read from an archive
+	maxArchiveEntries = 1024
+	// maxArchiveSize limits the total uncompressed size read from an archive
+	// to protect against zip bombs
+	maxArchiveSize = 16 << 20
+)
+
+// zipMagic and tarMagic identify the supported archive formats. The ustar
+// magic lives at tarMagicOffset in the first tar header.
+var (
+	zipMagic       = []byte("PK\x03\x04")
+	tarMagic       = []byte("ustar")
+	tarMagicOffset = 257
+)
+
+// errArchiveTooLarge is returned when an archive goes over maxArchiveSize
+var errArchiveTooLarge = errors.New("archive too large")
+
+// decodeArchive lists the entries of a zip (or jar) or tar archive and returns
+// a part for each entry that the policy accepts. Each part is tagged
+// with the archive type and the entry name. Office Open XML packages are
+// handed off to decodeOOXML.
+func decodeArchive(data []byte, accept AcceptPolicy) []decodedPart {
+	switch {
+	case bytes.HasPrefix(data, zipMagic):
+		return decodeZip(data, accept)
+	case len(data) > tarMagicOffset+len(tarMagic) &&
+		bytes.Equal(data[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic):
+		return decodeTar(data, accept)
+	}
+
+	return nil
+}
+
+// decodeZip returns the accepted entries of a zip archive
+func decodeZip(data []byte, accept AcceptPolicy) []decodedPart {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil
+	}
+	if isOOXML(reader) {
+		return decodeOOXML(reader, accept)
+	}
+
+	parts := []decodedPart{}
+	remaining := int64(maxArchiveSize)
+	for i, f := range reader.File {
+		if i >= maxArchiveEntries {
+			break
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		content, err := readZipFile(f, &remaining)
+		if errors.Is(err, errArchiveTooLarge) {
+			break
+		}
+		if err != nil {
+			continue
+		}
+
+		if part, ok := archivePart("zip", f.Name, content, accept); ok {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts
+}
+
+// decodeTar returns the accepted entries of a tar archive
+func decodeTar(data []byte, accept AcceptPolicy) []decodedPart {
+	reader := tar.NewReader(bytes.NewReader(data))
+
+	parts := []decodedPart{}
+	remaining := int64(maxArchiveSize)
+	for i := 0; i < maxArchiveEntries; i++ {
+		header, err := reader.Next()
+		if err != nil {
+			break
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		content, err := readArchiveEntry(reader, &remaining)
+		if err != nil {
+			break
+		}
+
+		if part, ok := archivePart("tar", header.Name, content, accept); ok {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts
+}
+
+// readZipFile reads a zip entry without going over the remaining budget
+func readZipFile(f *zip.File, remaining *int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return readArchiveEntry(rc, remaining)
+}
+
+// readArchiveEntry reads an entry without going over the remaining budget.
+// The sizes in archive headers can't be trusted so the budget is enforced
+// on the bytes actually read.
+func readArchiveEntry(r io.Reader, remaining *int64) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, *remaining+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > *remaining {
+		return nil, errArchiveTooLarge
+	}
+
+	*remaining -= int64(len(content))
+	return content, nil
+}
+
+// archivePart builds the part for an archive entry if the policy accepts it
+func archivePart(archiveType, name string, content []byte, accept AcceptPolicy) (decodedPart, bool) {
+	if len(content) == 0 || !accept(content) {
+		return decodedPart{}, false
+	}
+
+	return decodedPart{
+		value: string(content),
+		tags: []string{
+			"archive:" + archiveType,
+			"archive-entry:" + name,
+		},
+	}, true
+}
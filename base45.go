@@ -0,0 +1,153 @@
+package codec
+
+import (
+	"errors"
+	"strings"
+)
+
+// base45Alphabet is the RFC 9285 alphabet in value order
+const base45Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// minBase45Length is the shortest base45 payload that is decoded
+const minBase45Length = 12
+
+// base45ZlibHeaders are the base45 encodings of the zlib headers for each
+// compression level. Payloads are found by these since the alphabet is too
+// common on its own.
+var base45ZlibHeaders = []string{"V7F", "Y9F", "6BF", "NCF"}
+
+// base45Prefix is the prefix of EU digital COVID certificates. Payloads after
+// it are base45 even without a zlib header.
+const base45Prefix = "HC1:"
+
+// base45Values maps the alphabet to values and everything else to 0xff
+var base45Values [256]byte
+
+// isBase45Char is a lookup table of the base45 alphabet
+var isBase45Char [256]bool
+
+// errInvalidBase45 is returned for values that aren't valid base45
+var errInvalidBase45 = errors.New("invalid base45")
+
+func init() {
+	for i := range base45Values {
+		base45Values[i] = 0xff
+	}
+	for i := 0; i < len(base45Alphabet); i++ {
+		base45Values[base45Alphabet[i]] = byte(i)
+		isBase45Char[base45Alphabet[i]] = true
+	}
+}
+
+// findBase45 matches zlib compressed base45 payloads, with or without a
+// context prefix like the HC1: of EU digital COVID certificates, and
+// uncompressed payloads after HC1:. The prefix isn't part of the match.
+func findBase45(data string) []startEnd {
+	var matches []startEnd
+	for i := 0; i < len(data); i++ {
+		if !isBase45Char[data[i]] || data[i] == ' ' {
+			continue
+		}
+
+		start := i
+		for i < len(data) && isBase45Char[data[i]] {
+			i++
+		}
+		end := i
+		for end > start && data[end-1] == ' ' {
+			end--
+		}
+
+		// Skip runs that are stuck to the end of a word
+		if start > 0 && isB64Char[data[start-1]] {
+			continue
+		}
+
+		run := data[start:end]
+		prefix := strings.IndexByte(run[:min(len(run), 8)], ':') + 1
+		switch {
+		case strings.HasPrefix(run, base45Prefix):
+			start += len(base45Prefix)
+		case prefix > 0 && hasBase45ZlibHeader(run[prefix:]):
+			start += prefix
+		case !hasBase45ZlibHeader(run):
+			continue
+		}
+		if end-start < minBase45Length || (end-start)%3 == 1 {
+			continue
+		}
+
+		matches = append(matches, startEnd{start, end})
+	}
+
+	return matches
+}
+
+// hasBase45ZlibHeader returns true if the value starts with a zlib header
+func hasBase45ZlibHeader(v string) bool {
+	for _, header := range base45ZlibHeaders {
+		if strings.HasPrefix(v, header) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeBase45 decodes base45 payloads, inflating the ones that are zlib
+// compressed
+func decodeBase45(encodedValue string, config decodeConfig) []decodedPart {
+	decoded, err := decodeBase45Bytes(encodedValue)
+	if err != nil {
+		return nil
+	}
+	if !hasBase45ZlibHeader(encodedValue) {
+		return decodeBytes(decoded, config)
+	}
+
+	inflated, err := inflate(decoded)
+	if err != nil {
+		return nil
+	}
+	parts := decodeBytes(inflated, config)
+	for i := range parts {
+		parts[i].tags = append([]string{"compression:zlib"}, parts[i].tags...)
+	}
+
+	return parts
+}
+
+// decodeBase45Bytes decodes each group of three characters into two bytes
+// and a final group of two characters into one byte
+func decodeBase45Bytes(s string) ([]byte, error) {
+	if len(s)%3 == 1 {
+		return nil, errInvalidBase45
+	}
+
+	decoded := make([]byte, 0, len(s)/3*2+1)
+	for i := 0; i < len(s); i += 3 {
+		n := 0
+		size := min(3, len(s)-i)
+		for j := size - 1; j >= 0; j-- {
+			v := base45Values[s[i+j]]
+			if v == 0xff {
+				return nil, errInvalidBase45
+			}
+			n = n*45 + int(v)
+		}
+
+		if size == 3 {
+			if n > 0xffff {
+				return nil, errInvalidBase45
+			}
+			decoded = append(decoded, byte(n>>8), byte(n))
+		} else {
+			if n > 0xff {
+				return nil, errInvalidBase45
+			}
+			decoded = append(decoded, byte(n))
+		}
+	}
+
+	return decoded, nil
+}
@@ -2,8 +2,19 @@ package codec
 
 import (
 	"encoding/base64"
+	"strings"
 )
 
+// minBase64Length is the shortest run of base64 characters that is decoded
+const minBase64Length = 16
+
+// minKeywordBase64Length is the shortest run of base64 characters that is
+// decoded when it follows a keyword
+const minKeywordBase64Length = 8
+
+// maxBase64SuffixAttempts is the most suffixes of a value that are tried
+const maxBase64SuffixAttempts = 4
+
 // likelyBase64Chars is a set of characters that you would expect to find at
 // least one of in base64 encoded data. This risks missing about 1% of
 // base64 encoded data that doesn't contain these characters, but gives you
@@ -16,24 +27,171 @@ func init() {
 	}
 }
 
-// decodeBase64 decodes base64 encoded printable ASCII characters
-func decodeBase64(encodedValue string) string {
+// base64Variant is one of the ways base64 can be encoded
+type base64Variant struct {
+	// name is recorded in the segment tags
+	name string
+	// kind is base64Kind or base64URLKind depending on the alphabet
+	kind encodingKind
+	// encoding decodes the variant
+	encoding *base64.Encoding
+	// urlAlphabet is true if it uses - and _ instead of + and /
+	urlAlphabet bool
+	// padded is true if the variant expects = padding
+	padded bool
+}
+
+// base64Variants are tried in order. The standard alphabet goes first so
+// that values valid in both alphabets are reported as standard base64.
+var base64Variants = []base64Variant{
+	{"std", base64Kind, base64.StdEncoding, false, true},
+	{"raw-std", base64Kind, base64.RawStdEncoding, false, false},
+	{"url", base64URLKind, base64.URLEncoding, true, true},
+	{"raw-url", base64URLKind, base64.RawURLEncoding, true, false},
+}
+
+// base64MixedVariant decodes values that mix both alphabets after mapping
+// the URL alphabet onto the standard one
+var base64MixedVariant = base64Variant{"mixed", base64Kind, nil, false, false}
+
+// base64URLToStd maps the URL alphabet onto the standard one
+var base64URLToStd = strings.NewReplacer("-", "+", "_", "/")
+
+// decodeBase64 decodes base64 encoded values the policy accepts or archives.
+// When the whole value isn't base64, a suffix that is gets used instead (e.g.
+// the base64 in sk-live-dGhpcyBpcyBhIHNlY3JldA).
+func decodeBase64(encodedValue string, config decodeConfig) []decodedPart {
 	// Exit early if it doesn't seem like base64
-	if !hasByte(encodedValue, likelyBase64Chars) {
-		return ""
+	if config.likelyBase64 && !hasByte(encodedValue, likelyBase64Chars) {
+		return nil
+	}
+	if parts := decodeBase64Value(encodedValue, config); len(parts) > 0 {
+		return parts
+	}
+	// The policy rejected a value that's base64 on its own, so there's
+	// nothing stuck to the front of it
+	if isWholeBase64(encodedValue) {
+		return nil
 	}
 
-	// Try standard base64 decoding
-	decodedValue, err := base64.StdEncoding.DecodeString(encodedValue)
-	if err == nil && isPrintableASCII(decodedValue) {
-		return string(decodedValue)
+	return decodeBase64Suffix(encodedValue, config)
+}
+
+// isWholeBase64 returns true if the value is aligned, padded base64 in either
+// alphabet
+func isWholeBase64(encodedValue string) bool {
+	if len(encodedValue)%4 != 0 {
+		return false
+	}
+	if _, err := base64.StdEncoding.Strict().DecodeString(encodedValue); err == nil {
+		return true
 	}
+	_, err := base64.URLEncoding.Strict().DecodeString(encodedValue)
+	return err == nil
+}
+
+// decodeBase64Suffix looks for a suffix of the value that decodes. The
+// suffix after the last - or _ separator that leaves enough characters is
+// tried first (base64url can end in one). After that,
+// suffixes that start up to three characters later are tried to get back
+// into four character alignment when something without a separator was
+// stuck to the front. Only maxBase64SuffixAttempts suffixes are tried so
+// long values stay linear.
+func decodeBase64Suffix(encodedValue string, config decodeConfig) []decodedPart {
+	start := 0
+	for i := len(encodedValue) - config.minBase64Length - 1; i >= 0; i-- {
+		if encodedValue[i] == '-' || encodedValue[i] == '_' {
+			start = i + 1
+			break
+		}
+	}
+	for offset := 0; offset < maxBase64SuffixAttempts; offset++ {
+		i := start + offset
+		if i == 0 {
+			continue // the whole value was already tried
+		}
+		if len(encodedValue)-i < config.minBase64Length {
+			break
+		}
+		if config.likelyBase64 && !hasByte(encodedValue[i:], likelyBase64Chars) {
+			continue
+		}
+
+		parts := decodeBase64Value(encodedValue[i:], config)
+		if len(parts) == 0 {
+			continue
+		}
+		for j := range parts {
+			parts[j].span = startEnd{i, len(encodedValue)}
+		}
+		return parts
+	}
+
+	return nil
+}
+
+// decodeBase64Value decodes the value as a whole. All padded/unpadded and
+// standard/URL alphabet combinations are tried along with values that mix
+// both alphabets. It's up to the caller to decide if the value is likely
+// to be base64.
+func decodeBase64Value(encodedValue string, config decodeConfig) []decodedPart {
+	var parts []decodedPart
+	eachBase64Variant(encodedValue, func(variant base64Variant, decodedValue []byte) bool {
+		parts = variant.tag(decodeBytes(decodedValue, config))
+		return len(parts) > 0
+	})
+
+	return parts
+}
+
+// eachBase64Variant calls fn with the bytes from each variant that can
+// decode the value until fn returns true. Values that mix both alphabets
+// are tried last. It returns true if fn did.
+func eachBase64Variant(encodedValue string, fn func(base64Variant, []byte) bool) bool {
+	hasStdChars := strings.ContainsAny(encodedValue, "+/")
+	hasURLChars := strings.ContainsAny(encodedValue, "-_")
+	hasPadding := strings.HasSuffix(encodedValue, "=")
+
+	for _, variant := range base64Variants {
+		// Skip the variants that can't decode the value
+		if (variant.urlAlphabet && hasStdChars) || (!variant.urlAlphabet && hasURLChars) {
+			continue
+		}
+		if !variant.padded && hasPadding {
+			continue
+		}
+
+		decodedValue, err := variant.encoding.DecodeString(encodedValue)
+		if err != nil {
+			continue
+		}
+		if fn(variant, decodedValue) {
+			return true
+		}
+	}
+
+	if !hasStdChars || !hasURLChars {
+		return false
+	}
+
+	normalized := base64URLToStd.Replace(encodedValue)
+	decodedValue, err := base64.StdEncoding.DecodeString(normalized)
+	if err != nil && !hasPadding {
+		decodedValue, err = base64.RawStdEncoding.DecodeString(normalized)
+	}
+	if err != nil {
+		return false
+	}
+
+	return fn(base64MixedVariant, decodedValue)
+}
 
-	// Try base64url decoding
-	decodedValue, err = base64.RawURLEncoding.DecodeString(encodedValue)
-	if err == nil && isPrintableASCII(decodedValue) {
-		return string(decodedValue)
+// tag sets the kind of the parts and records the variant in their tags
+func (v base64Variant) tag(parts []decodedPart) []decodedPart {
+	for i := range parts {
+		parts[i].kind = v.kind
+		parts[i].tags = append([]string{"base64-variant:" + v.name}, parts[i].tags...)
 	}
 
-	return ""
+	return parts
 }
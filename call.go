@@ -0,0 +1,353 @@
+package codec
+
+import (
+	"strings"
+)
+
+// maxDecodeCallName limits how far back the name of a call is looked for
+const maxDecodeCallName = 64
+
+// isCallNameChar is a lookup table of the characters allowed in the dotted
+// name of a call (e.g. base64.b64decode)
+var isCallNameChar [256]bool
+
+func init() {
+	for c := '0'; c <= '9'; c++ {
+		isCallNameChar[c] = true
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		isCallNameChar[c] = true
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		isCallNameChar[c] = true
+	}
+	for _, c := range `_.$` {
+		isCallNameChar[c] = true
+	}
+}
+
+// decodeCallHint maps the end of a lowercased call name to the kind of
+// encoding its argument is decoded with
+type decodeCallHint struct {
+	suffix string
+	kind   encodingKind
+}
+
+// decodeCallHints are the calls whose string argument is decoded. Buffer.from
+// has no kind since it comes from its second argument.
+var decodeCallHints = []decodeCallHint{
+	{"atob", base64Kind},
+	{"b64decode", base64Kind},                   // Python base64.b64decode and friends
+	{"base64.decodebytes", base64Kind},          // Python
+	{"a2b_base64", base64Kind},                  // Python binascii
+	{"frombase64string", base64Kind},            // .NET Convert.FromBase64String
+	{"base64_decode", base64Kind},               // PHP
+	{"decode64", base64Kind},                    // Ruby Base64.decode64 and friends
+	{"decodebase64", base64Kind},                // Apache Commons Base64.decodeBase64
+	{"getdecoder().decode", base64Kind},         // Java Base64.getDecoder().decode
+	{"geturldecoder().decode", base64Kind},      // Java
+	{"getmimedecoder().decode", base64Kind},     // Java
+	{"stdencoding.decodestring", base64Kind},    // Go
+	{"rawstdencoding.decodestring", base64Kind}, // Go
+	{"urlencoding.decodestring", base64Kind},    // Go
+	{"rawurlencoding.decodestring", base64Kind}, // Go
+	{"hex.decodestring", hexKind},               // Go
+	{"unhex", hexKind},                          // SQL
+	{"unhexlify", hexKind},                      // Python binascii
+	{"a2b_hex", hexKind},                        // Python binascii
+	{"fromhex", hexKind},                        // Python bytes.fromhex
+	{"hex2bin", hexKind},                        // PHP
+	{"decodehex", hexKind},                      // Apache Commons Hex.decodeHex
+	{"b45decode", base45Kind},                   // Python base45.b45decode
+	{"base45.decode", base45Kind},               // JavaScript base45
+	{"buffer.from", 0},                          // Node.js
+}
+
+// decodeCall is a call that decodes a string literal, like atob("...") or
+// echo ... | base64 -d
+type decodeCall struct {
+	// name is the call as written (e.g. base64.b64decode or base64 -d)
+	name string
+	// kind is the kind of encoding the argument is decoded with
+	kind encodingKind
+	// arg is the contents of the argument
+	arg startEnd
+	// end is where the call ends
+	end int
+}
+
+// findDecodeCalls returns the decode calls in the data. The kind each call
+// decodes its argument with is found again by decodeCallArg.
+func findDecodeCalls(data string) []startEnd {
+	var matches []startEnd
+	last := 0
+	for i := 0; i < len(data); i++ {
+		start := i
+		switch {
+		case data[i] == '(':
+			start = decodeCallNameStart(data, i)
+			if start == i {
+				continue
+			}
+		case data[i] == 'e' && strings.HasPrefix(data[i:], "echo") &&
+			(i == 0 || !isCallNameChar[data[i-1]]):
+		default:
+			continue
+		}
+		if start < last {
+			continue
+		}
+
+		call, ok := parseDecodeCall(data, start)
+		if !ok {
+			continue
+		}
+		matches = append(matches, startEnd{start, call.end})
+		last = call.end
+		i = call.end - 1
+	}
+
+	return matches
+}
+
+// decodeCallNameStart returns where the name of the call with the opening
+// parenthesis at open starts. Empty calls like getDecoder() are part of the
+// name.
+func decodeCallNameStart(data string, open int) int {
+	j := open
+	for j > 0 && open-j < maxDecodeCallName {
+		if isCallNameChar[data[j-1]] {
+			j--
+		} else if j > 1 && data[j-1] == ')' && data[j-2] == '(' {
+			j -= 2
+		} else {
+			break
+		}
+	}
+
+	return j
+}
+
+// parseDecodeCall parses the decode call that starts at i
+func parseDecodeCall(data string, i int) (decodeCall, bool) {
+	if strings.HasPrefix(data[i:], "echo") {
+		return parseEchoDecodeCall(data, i)
+	}
+
+	// Read the name up to the parenthesis that isn't part of an empty call
+	j := i
+	for j < len(data) && j-i < maxDecodeCallName {
+		if isCallNameChar[data[j]] {
+			j++
+		} else if j+1 < len(data) && data[j] == '(' && data[j+1] == ')' {
+			j += 2
+		} else {
+			break
+		}
+	}
+	if j == i || j >= len(data) || data[j] != '(' {
+		return decodeCall{}, false
+	}
+
+	call := decodeCall{name: data[i:j]}
+	hint, ok := findDecodeCallHint(call.name)
+	if !ok {
+		return decodeCall{}, false
+	}
+	call.kind = hint.kind
+
+	arg, ok := readCallLiteral(data, skipCallSpace(data, j+1))
+	if !ok {
+		return decodeCall{}, false
+	}
+	call.arg = arg
+	call.end = arg.end + 1
+
+	// The literal has to be the whole first argument
+	j = skipCallSpace(data, call.end)
+	switch {
+	case j == len(data):
+	case data[j] == ')':
+		call.end = j + 1
+	case data[j] == ',':
+		if call.kind != 0 {
+			break
+		}
+		// Buffer.from("...", "base64")
+		codec, ok := readCallLiteral(data, skipCallSpace(data, j+1))
+		if !ok {
+			return decodeCall{}, false
+		}
+		switch strings.ToLower(data[codec.start:codec.end]) {
+		case "base64", "base64url":
+			call.kind = base64Kind
+		case "hex":
+			call.kind = hexKind
+		default:
+			return decodeCall{}, false
+		}
+		call.end = codec.end + 1
+		if j = skipCallSpace(data, call.end); j < len(data) && data[j] == ')' {
+			call.end = j + 1
+		}
+	default:
+		return decodeCall{}, false
+	}
+
+	return call, call.kind != 0
+}
+
+// parseEchoDecodeCall parses a shell pipeline like echo ... | base64 -d or
+// echo ... | xxd -r -p that starts at i
+func parseEchoDecodeCall(data string, i int) (decodeCall, bool) {
+	j := i + len("echo")
+	if j >= len(data) || (data[j] != ' ' && data[j] != '\t') {
+		return decodeCall{}, false
+	}
+
+	// Skip options like -n and -e
+	j = skipCallSpace(data, j)
+	for j < len(data) && data[j] == '-' {
+		j = skipCallSpace(data, skipShellWord(data, j))
+	}
+
+	call := decodeCall{}
+	if arg, ok := readCallLiteral(data, j); ok {
+		call.arg = arg
+		j = arg.end + 1
+	} else {
+		end := skipShellWord(data, j)
+		if end == j {
+			return decodeCall{}, false
+		}
+		call.arg = startEnd{j, end}
+		j = end
+	}
+
+	j = skipCallSpace(data, j)
+	if j >= len(data) || data[j] != '|' {
+		return decodeCall{}, false
+	}
+
+	command := skipCallSpace(data, j+1)
+	j = skipShellWord(data, command)
+	name := data[command:j]
+	var flags string
+	for {
+		k := skipCallSpace(data, j)
+		if k >= len(data) || data[k] != '-' {
+			break
+		}
+		j = skipShellWord(data, k)
+		flags += data[k:j]
+	}
+
+	switch name {
+	case "base64":
+		if strings.Contains(flags, "--decode") || strings.ContainsAny(flags, "dD") {
+			call.kind = base64Kind
+		}
+	case "xxd":
+		if strings.Contains(flags, "r") && strings.Contains(flags, "p") {
+			call.kind = hexKind
+		}
+	}
+	call.name = data[command:j]
+	call.end = j
+
+	return call, call.kind != 0
+}
+
+// findDecodeCallHint returns the hint for the call name. The hint has to
+// match a whole part of the name (e.g. b64decode in urlsafe_b64decode).
+func findDecodeCallHint(name string) (decodeCallHint, bool) {
+	name = strings.ToLower(name)
+	for _, hint := range decodeCallHints {
+		if !strings.HasSuffix(name, hint.suffix) {
+			continue
+		}
+		if b := len(name) - len(hint.suffix); b == 0 || name[b-1] == '.' || name[b-1] == '_' {
+			return hint, true
+		}
+	}
+
+	return decodeCallHint{}, false
+}
+
+// readCallLiteral returns the contents of the non-empty string literal at i.
+// Python b-prefixed literals are allowed. Literals with escapes aren't
+// supported.
+func readCallLiteral(data string, i int) (startEnd, bool) {
+	if i < len(data) && (data[i] == 'b' || data[i] == 'B') {
+		i++
+	}
+	if i >= len(data) || (data[i] != '"' && data[i] != '\'' && data[i] != '`') {
+		return startEnd{}, false
+	}
+
+	quote := data[i]
+	for j := i + 1; j < len(data); j++ {
+		switch data[j] {
+		case quote:
+			return startEnd{i + 1, j}, j > i+1
+		case '\\', '\n':
+			return startEnd{}, false
+		}
+	}
+
+	return startEnd{}, false
+}
+
+// skipCallSpace returns the index of the first non space or tab from i
+func skipCallSpace(data string, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t') {
+		i++
+	}
+
+	return i
+}
+
+// skipShellWord returns the index of the end of the unquoted shell word at i
+func skipShellWord(data string, i int) int {
+	for i < len(data) && !isWhitespace[data[i]] && !strings.ContainsRune("|;&<>()\"'`", rune(data[i])) {
+		i++
+	}
+
+	return i
+}
+
+// decodeCallArg decodes the argument of a decode call with the kind of
+// encoding the call uses. Since the call makes it clear what the argument is,
+// the length minimums and heuristics aren't applied.
+func decodeCallArg(encodedValue string, config decodeConfig) []decodedPart {
+	call, ok := parseDecodeCall(encodedValue, 0)
+	if !ok {
+		return nil
+	}
+
+	arg := encodedValue[call.arg.start:call.arg.end]
+	var parts []decodedPart
+	switch call.kind {
+	case base64Kind:
+		parts = decodeBase64Value(arg, config)
+	case hexKind:
+		config.hexRequiresDigit = false
+		parts = decodeHex(arg, config)
+	case base45Kind:
+		parts = decodeBase45(arg, config)
+	}
+
+	for i := range parts {
+		if parts[i].kind == 0 {
+			parts[i].kind = call.kind
+		}
+		if parts[i].span == (startEnd{}) {
+			parts[i].span = call.arg
+		} else {
+			parts[i].span = call.arg.narrow(parts[i].span)
+		}
+		parts[i].tags = append(parts[i].tags, "decode-call:"+call.name)
+	}
+
+	return parts
+}
@@ -0,0 +1,143 @@
+package codec
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// charsetThreshold is the text score that a value transcoded from one of the
+// configured charsets needs
+const charsetThreshold = 0.7
+
+// cp037Map maps CP037 (EBCDIC US/Canada) to Latin-1, which has the same
+// characters in a different order
+const cp037Map = "" +
+	"\x00\x01\x02\x03\x9c\x09\x86\x7f\x97\x8d\x8e\x0b\x0c\x0d\x0e\x0f" +
+	"\x10\x11\x12\x13\x9d\x85\x08\x87\x18\x19\x92\x8f\x1c\x1d\x1e\x1f" +
+	"\x80\x81\x82\x83\x84\x0a\x17\x1b\x88\x89\x8a\x8b\x8c\x05\x06\x07" +
+	"\x90\x91\x16\x93\x94\x95\x96\x04\x98\x99\x9a\x9b\x14\x15\x9e\x1a" +
+	"\x20\xa0\xe2\xe4\xe0\xe1\xe3\xe5\xe7\xf1\xa2\x2e\x3c\x28\x2b\x7c" +
+	"\x26\xe9\xea\xeb\xe8\xed\xee\xef\xec\xdf\x21\x24\x2a\x29\x3b\xac" +
+	"\x2d\x2f\xc2\xc4\xc0\xc1\xc3\xc5\xc7\xd1\xa6\x2c\x25\x5f\x3e\x3f" +
+	"\xf8\xc9\xca\xcb\xc8\xcd\xce\xcf\xcc\x60\x3a\x23\x40\x27\x3d\x22" +
+	"\xd8\x61\x62\x63\x64\x65\x66\x67\x68\x69\xab\xbb\xf0\xfd\xfe\xb1" +
+	"\xb0\x6a\x6b\x6c\x6d\x6e\x6f\x70\x71\x72\xaa\xba\xe6\xb8\xc6\xa4" +
+	"\xb5\x7e\x73\x74\x75\x76\x77\x78\x79\x7a\xa1\xbf\xd0\xdd\xde\xae" +
+	"\x5e\xa3\xa5\xb7\xa9\xa7\xb6\xbc\xbd\xbe\x5b\x5d\xaf\xa8\xb4\xd7" +
+	"\x7b\x41\x42\x43\x44\x45\x46\x47\x48\x49\xad\xf4\xf6\xf2\xf3\xf5" +
+	"\x7d\x4a\x4b\x4c\x4d\x4e\x4f\x50\x51\x52\xb9\xfb\xfc\xf9\xfa\xff" +
+	"\x5c\xf7\x53\x54\x55\x56\x57\x58\x59\x5a\xb2\xd4\xd6\xd2\xd3\xd5" +
+	"\x30\x31\x32\x33\x34\x35\x36\x37\x38\x39\xb3\xdb\xdc\xd9\xda\x9f"
+
+// windows1252High is Windows-1252 from 0x80 to 0x9f, where it differs from
+// Latin-1. The bytes it doesn't define are 0.
+var windows1252High = [32]rune{
+	0x20ac, 0, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017d, 0,
+	0, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0, 0x017e, 0x0178,
+}
+
+// charset is a single byte character set
+type charset struct {
+	name string
+	// runes maps each byte to a rune or -1 if the byte isn't defined
+	runes [256]rune
+}
+
+// charsets are the charsets that can be used in Decoder.Charsets by name
+var charsets = map[string]*charset{}
+
+func init() {
+	latin1 := &charset{name: "latin-1"}
+	windows1252 := &charset{name: "windows-1252"}
+	cp037 := &charset{name: "cp037"}
+	cp1047 := &charset{name: "cp1047"}
+	for i := range latin1.runes {
+		latin1.runes[i] = rune(i)
+		windows1252.runes[i] = rune(i)
+		cp037.runes[i] = rune(cp037Map[i])
+	}
+	for i, r := range windows1252High {
+		if r == 0 {
+			r = -1
+		}
+		windows1252.runes[0x80+i] = r
+	}
+
+	// CP1047 is CP037 with the brackets, caret, not sign, Y acute and
+	// diaeresis moved around
+	cp1047.runes = cp037.runes
+	for b, r := range map[byte]rune{0x5f: '^', 0xad: '[', 0xb0: '¬', 0xba: 'Ý', 0xbb: '¨', 0xbd: ']'} {
+		cp1047.runes[b] = r
+	}
+
+	// EBCDIC records end lines with NL (0x15), which is a control character
+	// in Unicode
+	cp037.runes[0x15] = '\n'
+	cp1047.runes[0x15] = '\n'
+
+	for _, c := range []*charset{latin1, windows1252, cp037, cp1047} {
+		charsets[c.name] = c
+	}
+}
+
+// transcode returns the bytes as UTF-8 in the first charset that they're
+// printable text in, along with the name of that charset
+func transcode(decoded []byte, config decodeConfig) (string, string, bool) {
+	var text strings.Builder
+	for _, c := range config.charsets {
+		text.Reset()
+		text.Grow(len(decoded))
+		ok := true
+		for _, b := range decoded {
+			r := c.runes[b]
+			if r < 0 || !isPrintableRune(r, utf8.RuneLen(r)) {
+				ok = false
+				break
+			}
+			text.WriteRune(r)
+		}
+
+		if ok && textScore(text.String()) >= charsetThreshold {
+			return text.String(), c.name, true
+		}
+	}
+
+	return "", "", false
+}
+
+// transcodeBytes is transcode for decoders that return decoded parts
+func transcodeBytes(decoded []byte, config decodeConfig) []decodedPart {
+	text, name, ok := transcode(decoded, config)
+	if !ok {
+		return nil
+	}
+
+	return []decodedPart{{value: text, tags: []string{"charset:" + name}}}
+}
+
+// textScore returns how much transcoded text looks like text from 0 to 1.
+// It's how many of the characters are letters, digits, spaces or
+// punctuation, scaled down when fewer than half of them are ASCII letters.
+// Most of the high bytes in these charsets are letters, so without the
+// second part random bytes would look like text.
+func textScore(text string) float64 {
+	total, common, asciiLetters := 0, 0, 0
+	for _, r := range text {
+		total++
+		switch {
+		case r < utf8.RuneSelf && (r|0x20) >= 'a' && (r|0x20) <= 'z':
+			common++
+			asciiLetters++
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsSpace(r), unicode.IsPunct(r):
+			common++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	return float64(common) / float64(total) * min(1, float64(asciiLetters)/float64(total)/0.5)
+}
@@ -0,0 +1,81 @@
+package codec
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// confusables maps letters from other scripts to the ASCII characters they
+// look like. It's a curated subset of Cyrillic, Greek, Armenian and Latin
+// lookalikes picked by hand, not the full Unicode confusables data.
+var confusables = map[rune]byte{
+	// Cyrillic
+	'\u0430': 'a', '\u0435': 'e', '\u043e': 'o', '\u0440': 'p', '\u0441': 'c', '\u0443': 'y',
+	'\u0445': 'x', '\u0455': 's', '\u0456': 'i', '\u0458': 'j', '\u04bb': 'h', '\u0501': 'd',
+	'\u051b': 'q', '\u051d': 'w', '\u04cf': 'l', '\u04af': 'y', '\u0410': 'A', '\u0412': 'B',
+	'\u0415': 'E', '\u041a': 'K', '\u041c': 'M', '\u041d': 'H', '\u041e': 'O', '\u0420': 'P',
+	'\u0421': 'C', '\u0422': 'T', '\u0425': 'X', '\u0423': 'Y', '\u0405': 'S', '\u0406': 'I',
+	'\u0408': 'J', '\u051a': 'Q', '\u051c': 'W', '\u04ae': 'Y', '\u04c0': 'l', '\u050c': 'G',
+	'\u04ba': 'h', '\u0417': '3',
+	// Greek
+	'\u03b1': 'a', '\u03bf': 'o', '\u03bd': 'v', '\u03c1': 'p', '\u03b9': 'i', '\u03f2': 'c',
+	'\u03f3': 'j', '\u0391': 'A', '\u0392': 'B', '\u0395': 'E', '\u0396': 'Z', '\u0397': 'H',
+	'\u0399': 'I', '\u039a': 'K', '\u039c': 'M', '\u039d': 'N', '\u039f': 'O', '\u03a1': 'P',
+	'\u03a4': 'T', '\u03a5': 'Y', '\u03a7': 'X', '\u03f9': 'C',
+	// Armenian
+	'\u0585': 'o', '\u057d': 'u', '\u0570': 'h', '\u0578': 'n', '\u0566': 'q', '\u0581': 'g',
+	// Latin
+	'\u0131': 'i', '\u0237': 'j', '\u0251': 'a', '\u0261': 'g',
+}
+
+// findConfusables matches the words that mix ASCII letters with letters
+// from other scripts that look like them. Words with other non-ASCII letters
+// are left alone since they're most likely real text in that script.
+func findConfusables(data string) []startEnd {
+	var matches []startEnd
+	for i := 0; i < len(data); {
+		if isWhitespace[data[i]] {
+			i++
+			continue
+		}
+
+		start := i
+		ascii, confusable, other := false, false, false
+		for i < len(data) && !isWhitespace[data[i]] {
+			if c := data[i]; c < utf8.RuneSelf {
+				ascii = ascii || (c|0x20 >= 'a' && c|0x20 <= 'z')
+				i++
+				continue
+			}
+
+			r, size := utf8.DecodeRuneInString(data[i:])
+			if _, ok := confusables[r]; ok {
+				confusable = true
+			} else if unicode.IsLetter(r) {
+				other = true
+			}
+			i += size
+		}
+
+		if ascii && confusable && !other {
+			matches = append(matches, startEnd{start, i})
+		}
+	}
+
+	return matches
+}
+
+// decodeConfusables folds the confusable letters of a word to ASCII, which
+// is its skeleton
+func decodeConfusables(encodedValue string, _ decodeConfig) []decodedPart {
+	return foldRunes(encodedValue, foldConfusable)
+}
+
+// foldConfusable returns the ASCII character a rune is confusable with
+func foldConfusable(r rune) (string, string, bool) {
+	if c, ok := confusables[r]; ok {
+		return string(rune(c)), "", true
+	}
+
+	return "", "", false
+}
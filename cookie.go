@@ -0,0 +1,249 @@
+package codec
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Lengths of the parts of signed session cookies
+const (
+	// minCookieSignatureLength is the length of an unpadded base64 SHA-1
+	// HMAC, the shortest signature Flask and Django use
+	minCookieSignatureLength = 27
+	// expressSignatureLength is the length of an unpadded base64 SHA-256
+	// HMAC used by Express
+	expressSignatureLength = 43
+	// maxExpressValueLength limits how far an Express value is scanned
+	maxExpressValueLength = 4096
+)
+
+// Lookup tables for the characters in session cookies. isB64Char mixes both
+// base64 alphabets, so these tell them apart to recognize each framework's
+// framing.
+var (
+	isBase62Char    [256]bool // 0-9, A-Z, a-z
+	isB64URLChar    [256]bool // base62 plus - and _
+	isNotB64StdChar [256]bool // everything but base62 plus + and /
+	isCookieChar    [256]bool // both base64 alphabets plus . : and =
+)
+
+func init() {
+	for c := '0'; c <= '9'; c++ {
+		isBase62Char[c] = true
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		isBase62Char[c] = true
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		isBase62Char[c] = true
+	}
+
+	for c := range isBase62Char {
+		isB64URLChar[c] = isBase62Char[c]
+		isNotB64StdChar[c] = !isBase62Char[c]
+		isCookieChar[c] = isBase62Char[c]
+	}
+	for _, c := range "-_" {
+		isB64URLChar[c] = true
+	}
+	for _, c := range "+/" {
+		isNotB64StdChar[c] = false
+	}
+	for _, c := range "-_+/.:=" {
+		isCookieChar[c] = true
+	}
+}
+
+// sessionCookie is a session cookie split into its parts
+type sessionCookie struct {
+	// framework is the framework that made the cookie
+	framework string
+	// payload is the encoded payload with the signature stripped
+	payload string
+	// compressed is true if the payload is zlib compressed
+	compressed bool
+}
+
+// findSessionCookies matches Flask, Django, Rails and Express session
+// cookies. Cookies whose payload isn't JSON are left to the scanner since
+// the framing alone is common (e.g. base64--digest).
+func findSessionCookies(data string) []startEnd {
+	var matches []startEnd
+	for i := 0; i < len(data); i++ {
+		if !isCookieChar[data[i]] || (i > 0 && isCookieChar[data[i-1]]) {
+			continue
+		}
+
+		// Split tokens like session=.eJw... at the = that isn't padding
+		start := i
+		for i < len(data) && isCookieChar[data[i]] {
+			if data[i] == '=' && i+1 < len(data) && data[i+1] != '=' && data[i+1] != '-' {
+				if _, ok := parseSessionCookie(data[start:i]); ok {
+					break
+				}
+				start = i + 1
+			}
+			i++
+		}
+		cookie, ok := parseSessionCookie(data[start:i])
+		if ok && cookie.framework != "express" && eachCookiePayload(cookie, func([]byte) bool { return true }) {
+			matches = append(matches, startEnd{start, i})
+		}
+	}
+
+	// Express values aren't limited to the cookie characters (e.g. the JSON
+	// in s:j:{...}) so they're found by their s: prefix
+	for i := 0; i < len(data); {
+		start := strings.Index(data[i:], "s:")
+		if start < 0 {
+			break
+		}
+		start += i
+		i = start + 2
+		if start > 0 && isBase62Char[data[start-1]] {
+			continue
+		}
+
+		if end, ok := findExpressCookieEnd(data, start); ok {
+			matches = append(matches, startEnd{start, end})
+			i = end
+		}
+	}
+
+	return matches
+}
+
+// findExpressCookieEnd returns the end of the Express signed cookie that
+// starts at the s: at start. The value ends at the first . followed by a
+// signature.
+func findExpressCookieEnd(data string, start int) (int, bool) {
+	for j := start + 2; j < len(data) && j-start < maxExpressValueLength; j++ {
+		switch data[j] {
+		case ' ', '\t', '\r', '\n', ';':
+			return 0, false
+		case '.':
+			end := j + 1 + expressSignatureLength
+			if j == start+2 || end > len(data) || (end < len(data) && !isNotB64StdChar[data[end]]) {
+				continue
+			}
+			if !hasByte(data[j+1:end], isNotB64StdChar[:]) {
+				return end, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// parseSessionCookie splits a cookie into its parts if it has the framing of
+// one of the frameworks
+func parseSessionCookie(token string) (sessionCookie, bool) {
+	if strings.HasPrefix(token, "s:") {
+		j := strings.LastIndexByte(token, '.')
+		if j <= 2 || len(token)-j-1 != expressSignatureLength || hasByte(token[j+1:], isNotB64StdChar[:]) {
+			return sessionCookie{}, false
+		}
+		return sessionCookie{framework: "express", payload: strings.TrimPrefix(token[2:j], "j:")}, true
+	}
+
+	// Rails: base64--digest
+	if i := strings.LastIndex(token, "--"); i > 0 {
+		digest := token[i+2:]
+		if (len(digest) != 40 && len(digest) != 64) || hasByte(digest, isNotHexChar[:]) {
+			return sessionCookie{}, false
+		}
+		return sessionCookie{framework: "rails", payload: token[:i]}, true
+	}
+
+	// Flask: [.]payload.timestamp.signature
+	// Django: [.]payload:timestamp:signature
+	compressed := strings.HasPrefix(token, ".")
+	body := strings.TrimPrefix(token, ".")
+	for _, framing := range []struct {
+		framework string
+		separator string
+		timestamp *[256]bool
+	}{
+		{"flask", ".", &isB64URLChar},
+		{"django", ":", &isBase62Char},
+	} {
+		parts := strings.Split(body, framing.separator)
+		if len(parts) != 3 || len(parts[0]) == 0 ||
+			len(parts[1]) < 4 || len(parts[1]) > 8 ||
+			len(parts[2]) < minCookieSignatureLength {
+			continue
+		}
+		if !isAll(parts[0], &isB64URLChar) || !isAll(parts[1], framing.timestamp) || !isAll(parts[2], &isB64URLChar) {
+			continue
+		}
+
+		return sessionCookie{framework: framing.framework, payload: parts[0], compressed: compressed}, true
+	}
+
+	return sessionCookie{}, false
+}
+
+// isAll returns true if all of the bytes are in the byteset
+func isAll(data string, byteset *[256]bool) bool {
+	for i := 0; i < len(data); i++ {
+		if !byteset[data[i]] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// decodeSessionCookie strips the signature from a session cookie and
+// returns its payload, decompressing it if needed. Flask, Django and Rails
+// payloads have to be JSON. Express values are used as is.
+func decodeSessionCookie(encodedValue string, config decodeConfig) []decodedPart {
+	cookie, ok := parseSessionCookie(encodedValue)
+	if !ok {
+		return nil
+	}
+
+	tags := []string{"cookie:" + cookie.framework}
+	if cookie.framework == "express" {
+		if !config.accept([]byte(cookie.payload)) {
+			return nil
+		}
+		return []decodedPart{{value: cookie.payload, tags: tags}}
+	}
+
+	var payload []byte
+	eachCookiePayload(cookie, func(decoded []byte) bool {
+		if !config.accept(decoded) {
+			return false
+		}
+		payload = decoded
+		return true
+	})
+	if payload == nil {
+		return nil
+	}
+	if cookie.compressed {
+		tags = append(tags, "compression:zlib")
+	}
+
+	return []decodedPart{{value: string(payload), tags: tags}}
+}
+
+// eachCookiePayload calls fn with each base64 variant of the cookie's payload
+// that is JSON once it's decompressed. It stops and returns true as soon as
+// fn does.
+func eachCookiePayload(cookie sessionCookie, fn func(decoded []byte) bool) bool {
+	return eachBase64Variant(cookie.payload, func(_ base64Variant, decoded []byte) bool {
+		if cookie.compressed {
+			inflated, err := inflate(decoded)
+			if err != nil {
+				return false
+			}
+			decoded = inflated
+		}
+		if !json.Valid(decoded) {
+			return false
+		}
+		return fn(decoded)
+	})
+}
@@ -0,0 +1,77 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Encoding is a custom codec that a Decoder can find and decode alongside
+// the built in ones (e.g. an internal token format)
+type Encoding interface {
+	// Name is the name used in decoded:<name> tags and to look up its
+	// policy in Decoder.EncodingPolicies
+	Name() string
+
+	// Detect returns the [start, end) byte offsets of the encoded values in
+	// the data, the same as regexp's FindAllStringIndex
+	Detect(data string) [][]int
+
+	// Decode returns the bytes an encoded value decodes to. The bytes are
+	// checked against the decoder's policy like those of the built in
+	// encodings.
+	Decode(encodedValue string) ([]byte, error)
+
+	// Precedence decides which encoding wins when matches overlap. The
+	// built in encodings range from 1 for base64 to 7 for encrypted
+	// envelopes.
+	Precedence() int
+}
+
+// errNoEncodingName is returned when registering an encoding without a name
+var errNoEncodingName = errors.New("encoding has no name")
+
+// Register adds a custom encoding to the decoder. Its name can't be the name
+// of a built in encoding or of one already registered with this decoder.
+func (d *Decoder) Register(e Encoding) error {
+	name := e.Name()
+	if name == "" {
+		return errNoEncodingName
+	}
+	kind := kindByName(name)
+	if kind <= lastBuiltInKind {
+		return fmt.Errorf("encoding %q is built in", name)
+	}
+	for _, custom := range d.custom {
+		if custom.kind == kind {
+			return fmt.Errorf("encoding %q is already registered", name)
+		}
+	}
+
+	d.custom = append(d.custom, customEncoding(e, kind))
+	return nil
+}
+
+// customEncoding adapts a custom encoding to the ones the decoder uses.
+// Spans outside of the data are dropped.
+func customEncoding(e Encoding, kind encodingKind) *encoding {
+	return &encoding{
+		kind: kind,
+		detect: func(data string, _ decodeConfig) []startEnd {
+			var matches []startEnd
+			for _, m := range e.Detect(data) {
+				if len(m) == 2 && 0 <= m[0] && m[0] < m[1] && m[1] <= len(data) {
+					matches = append(matches, startEnd{m[0], m[1]})
+				}
+			}
+			return matches
+		},
+		decode: func(encodedValue string, config decodeConfig) []decodedPart {
+			decoded, err := e.Decode(encodedValue)
+			if err != nil {
+				return nil
+			}
+			return decodeBytes(decoded, config)
+		},
+		precedence: e.Precedence(),
+	}
+}
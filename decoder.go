@@ -2,20 +2,150 @@ package codec
 
 import (
 	"bytes"
+	"slices"
+	"strings"
 
 	"github.com/betterleaks/betterleaks/logging"
 )
 
 // Decoder decodes various types of data in place
 type Decoder struct {
-	decodedMap map[string]string
+	// Policy decides which decoded values are kept. StrictASCII is used
+	// when it's nil. Set it before decoding since results are cached.
+	Policy AcceptPolicy
+
+	// EncodingPolicies overrides Policy for specific encodings by name
+	// (e.g. "hex")
+	EncodingPolicies map[string]AcceptPolicy
+
+	// Encodings are the names of the encodings that are decoded (e.g. "hex"
+	// or "base64"), including custom ones added with Register. All of them
+	// are decoded when it's nil and none when it's empty.
+	Encodings []string
+
+	// MinLengths are the fewest characters a value of the encoding with the
+	// name needs to be decoded. For hex and base64 runs they replace the
+	// defaults of 32 and 16 and values after a keyword can still be shorter.
+	// Values with their own minimum, like binary and decimal byte
+	// sequences, need to meet both.
+	MinLengths map[string]int
+
+	// MaxDepth stops decoding values that are already MaxDepth passes deep.
+	// There's no limit when it's 0.
+	MaxDepth int
+
+	// DisabledHeuristics are the heuristics that aren't used. All of them
+	// are used by default.
+	DisabledHeuristics Heuristic
+
+	// StrictPercent gives each cluster of percent escapes its own segment
+	// instead of spanning from the first to the last escape on a line. Only
+	// URL safe characters are allowed between the escapes in a cluster, so
+	// one bad byte doesn't stop the rest of the line from being decoded.
+	StrictPercent bool
+
+	// Keywords are sensitive words like password or token that short
+	// encoded values often follow. Hex and base64 runs that start within
+	// KeywordDistance bytes after one of them can be shorter than usual.
+	// Matching is case insensitive and only whole words of identifiers
+	// count (key matches DB_KEY and apiKey but not monkey). None are used by
+	// default.
+	Keywords []string
+
+	// KeywordDistance is how many bytes can be between the end of a keyword
+	// and the start of a run. defaultKeywordDistance is used when it's 0.
+	KeywordDistance int
+
+	// Deobfuscate brute forces the single byte XOR keys on decoded values
+	// the policy rejects and tries ROT13/ROT47 on the ones it accepts, which
+	// are only replaced when the result scores clearly higher. A result is
+	// only kept when it looks enough like text or identifiers. It's off by
+	// default since it's slow and can have false positives.
+	Deobfuscate bool
+
+	// DeobfuscateThreshold is the plaintext score from 0 to 1 that a
+	// deobfuscated value needs. defaultDeobfuscateThreshold is used when
+	// it's 0.
+	DeobfuscateThreshold float64
+
+	// MinByteSequenceLength is the fewest bytes that sequences of binary
+	// groups (01110011 01100101) or decimal bytes (115 101 99) need to be
+	// decoded. defaultMinByteSequenceLength is used when it's 0 and
+	// sequences shorter than minByteSequenceLength are never found.
+	MinByteSequenceLength int
+
+	// Charsets are the single byte charsets that decoded values the policy
+	// rejects are tried in, in order. A value is transcoded to UTF-8 from
+	// the first charset it's printable text in and tagged with the charset.
+	// The names are cp037, cp1047 (EBCDIC), windows-1252 and latin-1. None
+	// are tried by default.
+	Charsets []string
+
+	// Normalize removes zero width and bidi control characters and folds
+	// fullwidth and a curated set of other compatibility characters (e.g.
+	// ligatures and mathematical letters) to ASCII. The segments say what
+	// was removed or folded and match indexes inside of them map back to the
+	// exact characters. It's off by default.
+	Normalize bool
+
+	// FoldConfusables folds Cyrillic, Greek and other letters that look like
+	// ASCII ones (e.g. the Cyrillic a) to ASCII in words that mix them with
+	// ASCII letters. The segments are tagged decoded:confusable so deliberate
+	// obfuscation can be told apart. It's off by default.
+	FoldConfusables bool
+
+	// custom are the encodings added with Register
+	custom []*encoding
+
+	decodedMap map[decodedKey][]decodedPart
+}
+
+// decodedKey is what decoded values are cached by. The same value can be
+// matched by different encodings (e.g. hex after a keyword and base64
+// elsewhere).
+type decodedKey struct {
+	encoding     *encoding
+	encodedValue string
+}
+
+// NewDecoder creates a default decoder struct and applies the options to it.
+// Use Validate to check the names the options set.
+func NewDecoder(opts ...Option) *Decoder {
+	d := &Decoder{
+		decodedMap: make(map[decodedKey][]decodedPart),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
 }
 
-// NewDecoder creates a default decoder struct
-func NewDecoder() *Decoder {
-	return &Decoder{
-		decodedMap: make(map[string]string),
+// config returns the configuration that decoders use for an encoding
+func (d *Decoder) config(e *encoding) decodeConfig {
+	config := decodeConfig{
+		accept:                d.policy(e),
+		hexRequiresDigit:      d.DisabledHeuristics&LikelyHexChars == 0,
+		likelyBase64:          d.DisabledHeuristics&LikelyBase64Chars == 0,
+		minBase64Length:       d.minLength(base64Kind, minBase64Length),
+		minByteSequenceLength: d.MinByteSequenceLength,
+	}
+	if config.minByteSequenceLength <= 0 {
+		config.minByteSequenceLength = defaultMinByteSequenceLength
+	}
+	for _, name := range d.Charsets {
+		if c, ok := charsets[strings.ToLower(name)]; ok {
+			config.charsets = append(config.charsets, c)
+		}
 	}
+	if d.Deobfuscate {
+		config.deobfuscateThreshold = d.DeobfuscateThreshold
+		if config.deobfuscateThreshold <= 0 {
+			config.deobfuscateThreshold = defaultDeobfuscateThreshold
+		}
+	}
+
+	return config
 }
 
 // Decode returns the data with the values decoded in place along with the
@@ -44,62 +174,133 @@ func (d *Decoder) findEncodedSegments(data string, predecessors []*EncodedSegmen
 	if len(data) == 0 {
 		return []*EncodedSegment{}
 	}
+	if d.MaxDepth > 0 && len(predecessors) > 0 && predecessors[0].depth >= d.MaxDepth {
+		return []*EncodedSegment{}
+	}
 
 	decodedShift := 0
-	encodingMatches := findEncodingMatches(data)
+	encodingMatches := d.findEncodingMatches(data)
 	segments := make([]*EncodedSegment, 0, len(encodingMatches))
 	for _, m := range encodingMatches {
-		encodedValue := data[m.start:m.end]
-		decodedValue, alreadyDecoded := d.decodedMap[encodedValue]
-
-		if !alreadyDecoded {
-			decodedValue = m.encoding.decode(encodedValue)
-			d.decodedMap[encodedValue] = decodedValue
+		// Opaque matches were already reported unless they came out of
+		// something decoded in the last pass
+		if m.encoding.opaque && !isNewSpan(m.startEnd, predecessors) {
+			continue
 		}
 
-		if len(decodedValue) == 0 {
+		parts := d.decodeMatch(data, m)
+		if len(parts) == 0 && m.fallback != nil {
+			m = *m.fallback
+			parts = d.decodeMatch(data, m)
+		}
+		if len(parts) == 0 {
 			continue
 		}
 
-		segment := &EncodedSegment{
-			predecessors: predecessors,
-			original:     toOriginal(predecessors, m.startEnd),
-			encoded:      m.startEnd,
-			decoded: startEnd{
-				m.start + decodedShift,
-				m.start + decodedShift + len(decodedValue),
-			},
-			decodedValue: decodedValue,
-			encodings:    m.encoding.kind,
-			depth:        1,
+		// Some decoders only decode part of the match
+		encodedValue := data[m.start:m.end]
+		matched := m.startEnd
+		if span := parts[0].span; span.end != 0 {
+			matched = m.startEnd.narrow(span)
+			encodedValue = data[matched.start:matched.end]
 		}
 
-		// Shift decoded start and ends based on size changes
-		decodedShift += len(decodedValue) - len(encodedValue)
-
-		// Adjust depth and encoding if applicable
-		if len(segment.predecessors) != 0 {
-			// Set the depth based on the predecessors' depth in the previous pass
-			segment.depth = 1 + segment.predecessors[0].depth
-			// Adjust encodings
-			for _, p := range segment.predecessors {
-				if segment.encoded.overlaps(p.decoded) {
-					segment.encodings |= p.encodings
+		original := toOriginal(predecessors, matched)
+		encoded := matched
+		for i, part := range parts {
+			kind := m.encoding.kind
+			if part.kind != 0 {
+				kind = part.kind
+			}
+			var encodings kindSet
+			if !m.encoding.opaque {
+				// Opaque encodings didn't decode anything
+				encodings = newKindSet(kind)
+			}
+
+			decodedValue := part.value
+			if i > 0 {
+				// The first part replaces the encoded value, so the rest are
+				// inserted after it on their own lines
+				encoded = startEnd{matched.end, matched.end}
+				decodedValue = "\n" + decodedValue
+			}
+
+			segment := &EncodedSegment{
+				predecessors: predecessors,
+				original:     original,
+				encoded:      encoded,
+				decoded: startEnd{
+					encoded.start + decodedShift,
+					encoded.start + decodedShift + len(decodedValue),
+				},
+				decodedValue: decodedValue,
+				encodings:    encodings,
+				tags:         slices.Clip(part.tags),
+				offsets:      part.offsets,
+				depth:        1,
+				opaque:       m.encoding.opaque,
+			}
+
+			// Shift decoded start and ends based on size changes
+			decodedShift += len(decodedValue) - (encoded.end - encoded.start)
+
+			// Adjust depth, encodings and tags if applicable
+			if len(segment.predecessors) != 0 {
+				// Set the depth based on the predecessors' depth in the previous pass
+				segment.depth = 1 + segment.predecessors[0].depth
+				// Adjust encodings and tags
+				for _, p := range segment.predecessors {
+					if segment.encoded.overlaps(p.decoded) {
+						segment.encodings = segment.encodings.union(p.encodings)
+						segment.tags = appendUnique(segment.tags, p.tags...)
+					}
 				}
 			}
-		}
 
-		segments = append(segments, segment)
-		logging.Debug().
-			Str("decoder", m.encoding.kind.String()).
-			Msgf(
-				"segment found: original=%s pos=%s: %q -> %q",
-				segment.original,
-				segment.encoded,
-				encodedValue,
-				segment.decodedValue,
-			)
+			segments = append(segments, segment)
+			logging.Debug().
+				Str("decoder", kind.String()).
+				Msgf(
+					"segment found: original=%s pos=%s: %q -> %q",
+					segment.original,
+					segment.encoded,
+					encodedValue,
+					segment.decodedValue,
+				)
+		}
 	}
 
 	return segments
 }
+
+// decodeMatch returns the parts decoded from the match that the decoder
+// uses. Decoded values are cached.
+func (d *Decoder) decodeMatch(data string, m encodingMatch) []decodedPart {
+	key := decodedKey{m.encoding, data[m.start:m.end]}
+	parts, alreadyDecoded := d.decodedMap[key]
+
+	if !alreadyDecoded {
+		parts = m.encoding.decode(key.encodedValue, d.config(m.encoding))
+		d.decodedMap[key] = parts
+	}
+
+	return d.usedParts(parts, m.encoding.kind)
+}
+
+// isNewSpan returns true if the span is in the data for the first time,
+// which is the case in the first pass or when it overlaps something that was
+// decoded in the last pass
+func isNewSpan(span startEnd, predecessors []*EncodedSegment) bool {
+	if len(predecessors) == 0 {
+		return true
+	}
+
+	for _, p := range predecessors {
+		if !p.opaque && span.start < p.decoded.end && p.decoded.start < span.end {
+			return true
+		}
+	}
+
+	return false
+}
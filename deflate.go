@@ -0,0 +1,37 @@
+package codec
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+)
+
+// maxInflateSize limits how much data is decompressed from a single value
+// to protect against decompression bombs
+const maxInflateSize = 16 << 20
+
+// errInflateTooLarge is returned when decompressed data goes over
+// maxInflateSize
+var errInflateTooLarge = errors.New("inflated data too large")
+
+// inflate decompresses zlib data without going over maxInflateSize
+func inflate(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	inflated, err := io.ReadAll(io.LimitReader(reader, maxInflateSize+1))
+	if len(inflated) > maxInflateSize {
+		return nil, errInflateTooLarge
+	}
+	// Truncated streams are common (e.g. PDFs with a slightly off /Length) so
+	// keep what was recovered as long as something was
+	if err != nil && len(inflated) == 0 {
+		return nil, err
+	}
+
+	return inflated, nil
+}
@@ -0,0 +1,164 @@
+package codec
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// defaultDeobfuscateThreshold is the plaintext score a deobfuscated
+	// value needs when Decoder.DeobfuscateThreshold isn't set
+	defaultDeobfuscateThreshold = 0.8
+	// minDeobfuscateLength is the fewest bytes that are brute forced. With
+	// fewer, random bytes too often turn into something that looks like text.
+	minDeobfuscateLength = 12
+	// maxDeobfuscateLength is the most bytes that are brute forced
+	maxDeobfuscateLength = 64 << 10
+	// minROTGain is how much a ROT13/ROT47 candidate has to outscore a value
+	// the policy accepted to replace it
+	minROTGain = 0.2
+)
+
+// englishLetterLogOdds is log(26 * p) for the frequency p of each letter in
+// English text. It's positive for letters that show up more often than in
+// random text.
+var englishLetterLogOdds [26]float64
+
+// isPlaintextPunct is a lookup table of the punctuation that's common in
+// text and identifiers
+var isPlaintextPunct [256]bool
+
+func init() {
+	frequencies := [26]float64{
+		8.2, 1.5, 2.8, 4.3, 12.7, 2.2, 2.0, 6.1, 7.0, 0.15, 0.77, 4.0, 2.4,
+		6.7, 7.5, 1.9, 0.095, 6.0, 6.3, 9.1, 2.8, 0.98, 2.4, 0.15, 2.0, 0.074,
+	}
+	total := 0.0
+	for _, f := range frequencies {
+		total += f
+	}
+	for i, f := range frequencies {
+		englishLetterLogOdds[i] = math.Log(26 * f / total)
+	}
+
+	for _, c := range " _-.:/=@," {
+		isPlaintextPunct[c] = true
+	}
+}
+
+// plaintextScore returns how much the bytes look like English text or
+// identifiers from 0 to 1. It's a mix of how many of the bytes are letters,
+// digits and common punctuation, how many are letters, and how closely the
+// letters follow English letter frequencies.
+func plaintextScore(b []byte) float64 {
+	if len(b) == 0 {
+		return 0
+	}
+
+	common := 0
+	letters := 0
+	logOdds := 0.0
+	for _, c := range b {
+		lower := c | 0x20
+		switch {
+		case lower >= 'a' && lower <= 'z':
+			common++
+			letters++
+			logOdds += englishLetterLogOdds[lower-'a']
+		case c >= '0' && c <= '9', isPlaintextPunct[c]:
+			common++
+		}
+	}
+	if letters == 0 {
+		return 0
+	}
+
+	// English text averages about 0.3 and random letters about -0.5
+	frequencyScore := min(1, max(0, (logOdds/float64(letters)+1)/1.3))
+	letterScore := min(1, float64(letters)/float64(len(b))/0.6)
+
+	return float64(common) / float64(len(b)) * (frequencyScore + letterScore) / 2
+}
+
+// deobfuscate brute forces single byte XOR keys and, for printable ASCII,
+// ROT13/ROT47 on decoded bytes. Values the policy accepted only get ROT13
+// and ROT47, and only when they don't already score over the threshold. The
+// best scoring candidate over the threshold is returned with the key in its
+// tags.
+func deobfuscate(decoded []byte, accepted bool, config decodeConfig) []decodedPart {
+	if config.deobfuscateThreshold <= 0 || len(decoded) < minDeobfuscateLength || len(decoded) > maxDeobfuscateLength {
+		return nil
+	}
+
+	var best []byte
+	bestTag := ""
+	bestKey := 0
+	bestScore := 0.0
+	if accepted {
+		// Accepted values are kept unless a candidate clearly beats them
+		bestScore = plaintextScore(decoded)
+		if bestScore >= config.deobfuscateThreshold {
+			return nil
+		}
+		bestScore += minROTGain
+	}
+	candidate := make([]byte, len(decoded))
+	// try keeps the candidate if it's the best so far. The tag of XOR keys
+	// is only formatted for the best one.
+	try := func(tag string, key int) {
+		if !isPrintableASCII(candidate) || !config.accept(candidate) {
+			return
+		}
+		if score := plaintextScore(candidate); score > bestScore {
+			best = append(best[:0], candidate...)
+			bestTag, bestKey, bestScore = tag, key, score
+		}
+	}
+
+	if isPrintableASCII(decoded) {
+		for i, b := range decoded {
+			candidate[i] = rot13(b)
+		}
+		try("rot:13", 0)
+		for i, b := range decoded {
+			candidate[i] = rot47(b)
+		}
+		try("rot:47", 0)
+	}
+	for key := 1; key <= 0xff && !accepted; key++ {
+		for i, b := range decoded {
+			candidate[i] = b ^ byte(key)
+		}
+		try("", key)
+	}
+
+	if best == nil || bestScore < config.deobfuscateThreshold {
+		return nil
+	}
+	if bestTag == "" {
+		bestTag = fmt.Sprintf("xor-key:0x%02x", bestKey)
+	}
+
+	return []decodedPart{{value: string(best), tags: []string{bestTag}}}
+}
+
+// rot13 rotates letters by 13
+func rot13(b byte) byte {
+	switch {
+	case b >= 'a' && b <= 'z':
+		return 'a' + (b-'a'+13)%26
+	case b >= 'A' && b <= 'Z':
+		return 'A' + (b-'A'+13)%26
+	}
+
+	return b
+}
+
+// rot47 rotates the printable ASCII characters other than space by 47
+func rot47(b byte) byte {
+	if b >= '!' && b <= '~' {
+		return '!' + (b-'!'+47)%94
+	}
+
+	return b
+}
@@ -0,0 +1,165 @@
+package codec
+
+import (
+	"strings"
+)
+
+// Lengths of binary and decimal byte sequences
+const (
+	// defaultMinByteSequenceLength is the fewest bytes a sequence needs
+	// when Decoder.MinByteSequenceLength isn't set
+	defaultMinByteSequenceLength = 6
+	// minByteSequenceLength is the fewest bytes a sequence needs to be
+	// found at all, whatever Decoder.MinByteSequenceLength is
+	minByteSequenceLength = 4
+)
+
+// isDigitSequenceChar is a lookup table of the characters that can't touch
+// either end of a sequence since they'd make it part of a word, version or
+// larger number
+var isDigitSequenceChar [256]bool
+
+func init() {
+	for c := '0'; c <= '9'; c++ {
+		isDigitSequenceChar[c] = true
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		isDigitSequenceChar[c] = true
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		isDigitSequenceChar[c] = true
+	}
+	for _, c := range "._-+" {
+		isDigitSequenceChar[c] = true
+	}
+}
+
+// parseBinaryByte parses an 8 bit group like 01110011
+func parseBinaryByte(token string) (byte, bool) {
+	if len(token) != 8 {
+		return 0, false
+	}
+
+	var b byte
+	for i := 0; i < len(token); i++ {
+		if token[i] != '0' && token[i] != '1' {
+			return 0, false
+		}
+		b = b<<1 | (token[i] - '0')
+	}
+
+	return b, true
+}
+
+// parseDecimalByte parses a decimal byte from 0 to 255
+func parseDecimalByte(token string) (byte, bool) {
+	if len(token) == 0 || len(token) > 3 {
+		return 0, false
+	}
+
+	n := 0
+	for i := 0; i < len(token); i++ {
+		if token[i] < '0' || token[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int(token[i]-'0')
+	}
+	if n > 0xff {
+		return 0, false
+	}
+
+	return byte(n), true
+}
+
+// findBinaryBytes matches space or comma separated 8 bit groups like
+// 01110011 01100101
+func findBinaryBytes(data string, config decodeConfig) []startEnd {
+	return findByteSequences(data, parseBinaryByte, config)
+}
+
+// findDecimalBytes matches space or comma separated decimal bytes like
+// 115 101 99 or 115,101,99
+func findDecimalBytes(data string, config decodeConfig) []startEnd {
+	return findByteSequences(data, parseDecimalByte, config)
+}
+
+// findByteSequences matches sequences of tokens that parse as bytes with at
+// least as many tokens as the configured minimum, and never fewer than
+// minByteSequenceLength. The separator between the tokens has to be the same
+// throughout a sequence.
+func findByteSequences(data string, parse func(string) (byte, bool), config decodeConfig) []startEnd {
+	minTokens := max(minByteSequenceLength, config.minByteSequenceLength)
+	var matches []startEnd
+	for i := 0; i < len(data); i++ {
+		if isDigitSequenceChar[data[i]] && i > 0 && isDigitSequenceChar[data[i-1]] {
+			continue
+		}
+		// The digits of %XX and \NNN escapes aren't bytes on their own
+		if i > 0 && (data[i-1] == '%' || data[i-1] == '\\') {
+			continue
+		}
+
+		start := i
+		end, count := start, 0
+		separator := ""
+		for {
+			tokenEnd := i
+			for tokenEnd < len(data) && isDigitSequenceChar[data[tokenEnd]] {
+				tokenEnd++
+			}
+			if _, ok := parse(data[i:tokenEnd]); !ok {
+				break
+			}
+			end, count = tokenEnd, count+1
+
+			next := tokenEnd
+			for next < len(data) && (data[next] == ' ' || data[next] == ',') {
+				next++
+			}
+			if next == tokenEnd || (separator != "" && data[tokenEnd:next] != separator) {
+				break
+			}
+			separator = data[tokenEnd:next]
+			i = next
+		}
+
+		if count >= minTokens {
+			matches = append(matches, startEnd{start, end})
+		}
+		i = max(end, start)
+	}
+
+	return matches
+}
+
+// decodeBinaryBytes decodes a sequence of 8 bit groups
+func decodeBinaryBytes(encodedValue string, config decodeConfig) []decodedPart {
+	return decodeByteSequence(encodedValue, parseBinaryByte, config)
+}
+
+// decodeDecimalBytes decodes a sequence of decimal bytes
+func decodeDecimalBytes(encodedValue string, config decodeConfig) []decodedPart {
+	return decodeByteSequence(encodedValue, parseDecimalByte, config)
+}
+
+// decodeByteSequence parses each token of a sequence into a byte and decodes
+// them if there are enough
+func decodeByteSequence(encodedValue string, parse func(string) (byte, bool), config decodeConfig) []decodedPart {
+	tokens := strings.FieldsFunc(encodedValue, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	if len(tokens) < config.minByteSequenceLength {
+		return nil
+	}
+
+	decoded := make([]byte, 0, len(tokens))
+	for _, token := range tokens {
+		b, ok := parse(token)
+		if !ok {
+			return nil
+		}
+		decoded = append(decoded, b)
+	}
+
+	return decodeBytes(decoded, config)
+}
@@ -1,7 +1,9 @@
 package codec
 
 import (
-	"math"
+	"slices"
+	"sort"
+	"strings"
 )
 
 // Lookup tables for byte classification.
@@ -10,6 +12,9 @@ var (
 	isB64Char    [256]bool // 0-9, A-Z, a-z, _, /, +, -  (matches [\w\/+-])
 	isB64NotHex  [256]bool // b64 chars that are NOT hex (G-Z, g-z, _, /, +, -)
 	isWhitespace [256]bool // space, tab, \n, \r, etc.
+
+	isNotHexChar   [256]bool // the inverse of isHexChar
+	isHexSeparator [256]bool // b64 chars that split hex pieces in a run (_, /, +, -)
 )
 
 func init() {
@@ -42,6 +47,13 @@ func init() {
 	isB64Char['-'] = true
 	isB64NotHex['-'] = true
 
+	for c := range isNotHexChar {
+		isNotHexChar[c] = !isHexChar[c]
+	}
+	for _, c := range `_/+-` {
+		isHexSeparator[c] = true
+	}
+
 	isWhitespace[' '] = true
 	isWhitespace['\t'] = true
 	isWhitespace['\n'] = true
@@ -59,7 +71,7 @@ var (
 		},
 		{
 			kind:       unicodeKind,
-			decode:     decodeUnicode,
+			decode:     decodeValue(decodeUnicode),
 			precedence: 3,
 		},
 		{
@@ -72,94 +84,459 @@ var (
 			decode:     decodeBase64,
 			precedence: 1,
 		},
+		{
+			kind:       pdfKind,
+			detect:     detectSpans(findPDFStreams),
+			decode:     decodePDFStream,
+			precedence: 5,
+		},
+		{
+			kind:       ooxmlKind,
+			detect:     detectSpans(findOOXMLPackage),
+			decode:     decodeOOXMLPackage,
+			precedence: 6,
+		},
+		{
+			kind:       formKind,
+			decode:     decodeForm,
+			precedence: 4,
+		},
+		{
+			// Decode calls have no kind of their own. Their parts have the
+			// kind the call decodes with.
+			detect:     detectSpans(findDecodeCalls),
+			decode:     decodeCallArg,
+			precedence: 5,
+			enabled: func(d *Decoder) bool {
+				return d.usesKind(base64Kind) || d.usesKind(hexKind) || d.usesKind(base45Kind)
+			},
+		},
+		{
+			kind:       base45Kind,
+			detect:     detectSpans(findBase45),
+			decode:     decodeBase45,
+			precedence: 5,
+		},
+		{
+			kind:       pgpKind,
+			detect:     detectSpans(findPGPArmor),
+			decode:     decodePGPArmor,
+			precedence: 5,
+		},
+		{
+			kind:       sshKind,
+			detect:     detectSpans(findSSHKeys),
+			decode:     decodeSSHKey,
+			precedence: 5,
+		},
+		{
+			kind:       cookieKind,
+			detect:     detectSpans(findSessionCookies),
+			decode:     decodeSessionCookie,
+			precedence: 5,
+		},
+		{
+			kind:       hexdumpKind,
+			detect:     detectSpans(findHexdumps),
+			decode:     decodeHexdump,
+			precedence: 5,
+		},
+		{
+			kind:       regKind,
+			detect:     detectSpans(findRegValues),
+			decode:     decodeRegValue,
+			precedence: 5,
+		},
+		{
+			kind:       binaryKind,
+			detect:     findBinaryBytes,
+			decode:     decodeBinaryBytes,
+			precedence: 1,
+		},
+		{
+			kind:       decimalKind,
+			detect:     findDecimalBytes,
+			decode:     decodeDecimalBytes,
+			precedence: 1,
+		},
+		{
+			kind:       normalizedKind,
+			detect:     detectSpans(findNormalizable),
+			decode:     decodeNormalizable,
+			precedence: 6,
+			enabled:    func(d *Decoder) bool { return d.Normalize },
+		},
+		{
+			kind:       confusableKind,
+			detect:     detectSpans(findConfusables),
+			decode:     decodeConfusables,
+			precedence: 6,
+			enabled:    func(d *Decoder) bool { return d.FoldConfusables },
+		},
+		encryptedEnvelope("ansible-vault", findAnsibleVaults),
+		encryptedEnvelope("sops", findSOPSValues),
+		encryptedEnvelope("age", findAgeArmor),
+		encryptedEnvelope("sealed-secret", findSealedSecrets),
+		encryptedEnvelope("aws-kms", findAWSKMSCiphertexts),
 	}
 )
 
-// encodingNames is used to map the encodingKinds to their name
-var encodingNames = []string{
-	"percent",
-	"unicode",
-	"hex",
-	"base64",
-}
-
-// encodingKind can be or'd together to capture all of the unique encodings
-// that were present in a segment
+// encodingKind identifies an encoding. The built in kinds come first and
+// the kinds of custom encodings are added after them as they're registered.
+// 0 isn't a kind.
 type encodingKind int
 
-var (
-	// make sure these go up by powers of 2
-	percentKind = encodingKind(1)
-	unicodeKind = encodingKind(2)
-	hexKind     = encodingKind(4)
-	base64Kind  = encodingKind(8)
+const (
+	percentKind encodingKind = iota + 1
+	unicodeKind
+	hexKind
+	base64Kind
+	pdfKind
+	ooxmlKind
+	base64URLKind
+	formKind
+	base45Kind
+	pgpKind
+	sshKind
+	cookieKind
+	encryptedKind
+	hexdumpKind
+	binaryKind
+	decimalKind
+	regKind
+	normalizedKind
+	confusableKind
+
+	// lastBuiltInKind is the last of the built in kinds
+	lastBuiltInKind = confusableKind
 )
 
+// String returns the name of the kind
 func (e encodingKind) String() string {
-	i := int(math.Log2(float64(e)))
-	if i >= len(encodingNames) {
-		return ""
-	}
-	return encodingNames[i]
-}
+	kindNames.RLock()
+	defer kindNames.RUnlock()
 
-// kinds returns a list of encodingKinds combined in this one
-func (e encodingKind) kinds() []encodingKind {
-	kinds := []encodingKind{}
-
-	for i := 0; i < len(encodingNames); i++ {
-		if kind := int(e) & int(math.Pow(2, float64(i))); kind != 0 {
-			kinds = append(kinds, encodingKind(kind))
-		}
+	i := int(e) - 1
+	if i < 0 || i >= len(kindNames.names) {
+		return ""
 	}
-
-	return kinds
+	return kindNames.names[i]
 }
 
 // encodingMatch represents a match of an encoding in the text
 type encodingMatch struct {
 	encoding *encoding
 	startEnd
+	// fallback is tried when nothing decodes from the match (e.g. the whole
+	// run as base64 when its hex piece isn't text)
+	fallback *encodingMatch
 }
 
 // encoding represent a type of coding supported by the decoder.
 type encoding struct {
-	// the kind of decoding (e.g. base64, etc)
+	// the kind of decoding (e.g. base64, etc). It's 0 for encodings whose
+	// parts all set their own kind.
 	kind encodingKind
-	// take the match and return the decoded value
-	decode func(string) string
+	// find the matches in the data for encodings that can't be found by the
+	// byte-level scanner. Nil for the ones it handles.
+	detect func(string, decodeConfig) []startEnd
+	// take the match and return the decoded parts the policy accepts
+	decode func(string, decodeConfig) []decodedPart
 	// determine which encoding should win out when two overlap
 	precedence int
+	// opaque encodings (e.g. encrypted blobs) tag their matches without
+	// decoding them. The matches are only reported the first time they're
+	// seen and nothing else is decoded inside of them.
+	opaque bool
+	// enabled returns true if a decoder uses the encoding. Encodings without
+	// it are always used.
+	enabled func(*Decoder) bool
+}
+
+// decodedPart is a piece of the value decoded from a match. Most encodings
+// produce a single part, but containers (e.g. archives) produce one part per
+// entry so that each can carry its own tags.
+type decodedPart struct {
+	// value is the decoded text
+	value string
+	// kind overrides the kind of the encoding when set (e.g. base64url)
+	kind encodingKind
+	// span is the part of the encoded value that was decoded, relative to
+	// the start of the match. The whole match is used when it's empty.
+	span startEnd
+	// tags are extra meta data tags describing where the value came from
+	tags []string
+	// offsets maps each byte of the value, and the end of it, to its offset
+	// in the decoded span. Without it the whole value maps to the whole span.
+	offsets []int
+}
+
+// decodeConfig is the configuration from the Decoder that decoders use
+type decodeConfig struct {
+	// accept is the policy that applies to the encoding
+	accept AcceptPolicy
+	// hexRequiresDigit is true if hex values need at least one digit
+	hexRequiresDigit bool
+	// likelyBase64 is true if base64 values need one of the
+	// likelyBase64Chars
+	likelyBase64 bool
+	// minBase64Length is the shortest base64 suffix that is tried
+	minBase64Length int
+	// deobfuscateThreshold is the plaintext score XOR and ROT brute forcing
+	// needs. It's 0 when brute forcing is off.
+	deobfuscateThreshold float64
+	// minByteSequenceLength is the fewest bytes binary and decimal
+	// sequences need
+	minByteSequenceLength int
+	// charsets are tried in order on decoded values the policy rejects
+	charsets []*charset
+}
+
+// detectSpans wraps a detect function so that it can be used as an
+// encoding's detect function. It's meant for detectors that don't depend on
+// the decoder's configuration.
+func detectSpans(detect func(string) []startEnd) func(string, decodeConfig) []startEnd {
+	return func(data string, _ decodeConfig) []startEnd {
+		return detect(data)
+	}
+}
+
+// decodeValue wraps a decode function that produces a single value so that
+// it can be used as an encoding's decode function. It's meant for decoders
+// whose output doesn't need to be checked against the policy.
+func decodeValue(decode func(string) string) func(string, decodeConfig) []decodedPart {
+	return func(encodedValue string, _ decodeConfig) []decodedPart {
+		decodedValue := decode(encodedValue)
+		if len(decodedValue) == 0 {
+			return nil
+		}
+		return []decodedPart{{value: decodedValue}}
+	}
+}
+
+// decodeBytes turns the raw bytes produced by a decoder into decoded parts.
+// Values the policy accepts are kept as is and archives are expanded into
+// their entries. Values that don't look like text are transcoded from the
+// configured charsets, or deobfuscated if brute forcing is on.
+func decodeBytes(decoded []byte, config decodeConfig) []decodedPart {
+	if len(decoded) == 0 {
+		return nil
+	}
+	if config.accept(decoded) {
+		if parts := deobfuscate(decoded, true, config); len(parts) > 0 {
+			return parts
+		}
+		return []decodedPart{{value: string(decoded)}}
+	}
+	if parts := decodeArchive(decoded, config.accept); len(parts) > 0 {
+		return parts
+	}
+	if parts := transcodeBytes(decoded, config); len(parts) > 0 {
+		return parts
+	}
+	return deobfuscate(decoded, false, config)
 }
 
 // findEncodingMatches finds as many encodings as it can for this pass
-// using a single-pass byte-level scanner instead of regex.
-func findEncodingMatches(data string) []encodingMatch {
-	n := len(data)
-	if n == 0 {
+// using a single-pass byte-level scanner instead of regex. Encodings with
+// their own detectors claim their spans first and the scanner skips them,
+// unless a scanner match with a higher precedence runs into them.
+func (d *Decoder) findEncodingMatches(data string) []encodingMatch {
+	if len(data) == 0 {
 		return nil
 	}
 
 	var all []encodingMatch
-	i := 0
+	scanStart := 0
+	for _, region := range d.findRegionMatches(data) {
+		if region.start < scanStart {
+			continue // inside a scanner match that won
+		}
+
+		before := len(all)
+		all = d.scanEncodings(data, scanStart, region.start, all)
+		if last := len(all) - 1; last >= before && all[last].end > region.start {
+			if all[last].encoding.precedence > region.encoding.precedence {
+				scanStart = all[last].end
+				continue
+			}
+			// Scanning a prefix of the data keeps the offsets the same
+			// while stopping the scanner at the start of the region
+			all = d.scanEncodings(data[:region.start], scanStart, region.start, all[:before])
+		}
+		all = append(all, region)
+		scanStart = region.end
+	}
+	all = d.scanEncodings(data, scanStart, len(data), all)
+	if len(d.MinLengths) > 0 {
+		all = slices.DeleteFunc(all, func(m encodingMatch) bool {
+			return !d.longEnough(m)
+		})
+	}
+
+	totalMatches := len(all)
+	if totalMatches <= 1 {
+		return all
+	}
+
+	// filter out lower precedence ones that overlap their neighbors
+	filtered := make([]encodingMatch, 0, len(all))
+	for i, m := range all {
+		if i > 0 {
+			prev := all[i-1]
+			if m.overlaps(prev.startEnd) && prev.encoding.precedence > m.encoding.precedence {
+				continue // skip this one
+			}
+		}
+		if i+1 < totalMatches {
+			next := all[i+1]
+			if m.overlaps(next.startEnd) && next.encoding.precedence > m.encoding.precedence {
+				continue // skip this one
+			}
+		}
+		filtered = append(filtered, m)
+	}
+
+	return filtered
+}
+
+// findRegionMatches runs the detectors of the encodings that have them and
+// returns their matches ordered by start. When two overlap, the one with
+// the higher precedence wins.
+func (d *Decoder) findRegionMatches(data string) []encodingMatch {
+	var regions []encodingMatch
+	for _, list := range [][]*encoding{encodings, d.custom} {
+		for _, e := range list {
+			if e.detect == nil || !d.uses(e) {
+				continue
+			}
+			for _, se := range e.detect(data, d.config(e)) {
+				if m := (encodingMatch{encoding: e, startEnd: se}); d.longEnough(m) {
+					regions = append(regions, m)
+				}
+			}
+		}
+	}
+
+	if len(regions) <= 1 {
+		return regions
+	}
+
+	sort.SliceStable(regions, func(i, j int) bool {
+		return regions[i].start < regions[j].start
+	})
+
+	filtered := regions[:1]
+	for _, m := range regions[1:] {
+		last := &filtered[len(filtered)-1]
+		if m.start >= last.end {
+			filtered = append(filtered, m)
+		} else if m.encoding.precedence > last.encoding.precedence {
+			*last = m
+		}
+	}
+
+	return filtered
+}
 
-	for i < n {
+// findHexPiece returns the longest piece of a run between - _ + or /
+// separators that is hex with at least minLength digits, allowing for a 0x
+// prefix
+func findHexPiece(run string, minLength int) (startEnd, bool) {
+	if len(run) < minLength {
+		return startEnd{}, false
+	}
+
+	longest := startEnd{}
+	pieceStart := 0
+	for i := 0; i <= len(run); i++ {
+		if i < len(run) && isB64Char[run[i]] && !isHexSeparator[run[i]] {
+			continue
+		}
+
+		piece := startEnd{pieceStart, i}
+		digits := run[pieceStart:i]
+		if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+			digits = digits[2:]
+		}
+		if len(digits) >= minLength && !hasByte(digits, isNotHexChar[:]) &&
+			piece.end-piece.start > longest.end-longest.start {
+			longest = piece
+		}
+		pieceStart = i + 1
+	}
+
+	return longest, longest.end != 0
+}
+
+// scanEncodings scans the data from i with the byte-level scanner and
+// appends the matches it finds to all. No matches start at or after stop,
+// but they can run past it.
+func (d *Decoder) scanEncodings(data string, i, stop int, all []encodingMatch) []encodingMatch {
+	n := len(data)
+	scanStart := i
+
+	usePercent, useUnicode := d.uses(encodings[0]), d.uses(encodings[1])
+	useHex, useBase64, useForm := d.uses(encodings[2]), d.uses(encodings[3]), d.uses(encodings[6])
+	minHexRun := d.minLength(hexKind, minHexLength)
+	minBase64Run := d.minLength(base64Kind, minBase64Length)
+
+	for i < stop {
 		c := data[i]
 
-		// --- Percent encoding: %XX ---
-		if c == '%' && i+2 < n && isHexChar[data[i+1]] && isHexChar[data[i+2]] {
+		// --- Percent encoding: %XX or %uXXXX ---
+		if c == '%' && (usePercent || useForm) && percentEscapeLen(data, i) > 0 {
+			// Query strings and form bodies also encode spaces as + so the
+			// whole token is decoded as a form
+			if useForm {
+				if token, ok := findFormToken(data, i, scanStart); ok {
+					// Anything earlier in the token gets decoded in the next pass
+					for len(all) > 0 && all[len(all)-1].end > token.start {
+						all = all[:len(all)-1]
+					}
+					all = append(all, encodingMatch{
+						encoding: encodings[6], // form
+						startEnd: token,
+					})
+					i = token.end
+					continue
+				}
+			}
+
+			if !usePercent {
+				i++
+				continue
+			}
+
 			start := i
-			// Scan forward to find the last %XX on this line.
-			// The regex `%XX(?:.*%XX)?` is greedy and matches from the first
-			// %XX through any chars (except \n) to the last %XX on the line.
-			lastPercentEnd := i + 3
-			j := i + 3
-			for j < n && data[j] != '\n' {
-				if data[j] == '%' && j+2 < n && isHexChar[data[j+1]] && isHexChar[data[j+2]] {
-					lastPercentEnd = j + 3
+			lastPercentEnd := i + percentEscapeLen(data, i)
+			j := lastPercentEnd
+			if d.StrictPercent {
+				// Scan forward to the last %XX in this cluster of escapes.
+				// Only URL safe characters are allowed between them.
+				for j < n {
+					if escapeLen := percentEscapeLen(data, j); escapeLen > 0 {
+						lastPercentEnd = j + escapeLen
+						j = lastPercentEnd
+						continue
+					}
+					if !isURLSafe[data[j]] {
+						break
+					}
+					j++
+				}
+			} else {
+				// Scan forward to find the last %XX on this line.
+				// The regex `%XX(?:.*%XX)?` is greedy and matches from the first
+				// %XX through any chars (except \n) to the last %XX on the line.
+				for j < n && data[j] != '\n' {
+					if escapeLen := percentEscapeLen(data, j); escapeLen > 0 {
+						lastPercentEnd = j + escapeLen
+					}
+					j++
 				}
-				j++
 			}
+
 			all = append(all, encodingMatch{
 				encoding: encodings[0], // percent
 				startEnd: startEnd{start, lastPercentEnd},
@@ -169,7 +546,7 @@ func findEncodingMatches(data string) []encodingMatch {
 		}
 
 		// --- Unicode code points: U+XXXX ---
-		if c == 'U' && i+5 < n && data[i+1] == '+' &&
+		if c == 'U' && useUnicode && i+5 < n && data[i+1] == '+' &&
 			isHexChar[data[i+2]] && isHexChar[data[i+3]] &&
 			isHexChar[data[i+4]] && isHexChar[data[i+5]] {
 			// Check that the next char after the 4 hex digits is whitespace or end.
@@ -215,7 +592,7 @@ func findEncodingMatches(data string) []encodingMatch {
 		if c == '\\' {
 			matched := false
 			// Check for \\uXXXX (double backslash)
-			if i+7 < n && data[i+1] == '\\' {
+			if useUnicode && i+7 < n && data[i+1] == '\\' {
 				uc := data[i+2]
 				if (uc == 'u' || uc == 'U') &&
 					isHexChar[data[i+3]] && isHexChar[data[i+4]] &&
@@ -256,7 +633,7 @@ func findEncodingMatches(data string) []encodingMatch {
 				}
 			}
 			// Check for \uXXXX (single backslash)
-			if !matched && i+5 < n {
+			if !matched && useUnicode && i+5 < n {
 				uc := data[i+1]
 				if (uc == 'u' || uc == 'U') &&
 					isHexChar[data[i+2]] && isHexChar[data[i+3]] &&
@@ -296,6 +673,27 @@ func findEncodingMatches(data string) []encodingMatch {
 					matched = true
 				}
 			}
+			// Check for \x7365... or \x73\x65... hex escapes
+			if !matched && useHex && i+2 < n && data[i+1] == 'x' && isHexChar[data[i+2]] {
+				start := i
+				digits := 0
+				j := i
+				for j+2 < n && data[j] == '\\' && data[j+1] == 'x' && isHexChar[data[j+2]] {
+					j += 2
+					for j < n && isHexChar[data[j]] {
+						digits++
+						j++
+					}
+				}
+				if digits >= minHexRun || (digits >= min(minHexRun, minKeywordHexLength) && d.followsKeyword(data, start)) {
+					all = append(all, encodingMatch{
+						encoding: encodings[2], // hex
+						startEnd: startEnd{start, j},
+					})
+					i = j
+					matched = true
+				}
+			}
 			if matched {
 				continue
 			}
@@ -315,6 +713,12 @@ func findEncodingMatches(data string) []encodingMatch {
 			runLen := i - start
 			end := i
 
+			minHex, minB64 := minHexRun, minBase64Run
+			if runLen < minHexRun && d.followsKeyword(data, start) {
+				minHex = min(minHexRun, minKeywordHexLength)
+				minB64 = min(minBase64Run, minKeywordBase64Length)
+			}
+
 			// Count trailing '=' (up to 2) for base64 padding
 			eqCount := 0
 			for eqCount < 2 && end < n && data[end] == '=' {
@@ -322,13 +726,27 @@ func findEncodingMatches(data string) []encodingMatch {
 				end++
 			}
 
-			if allHex && runLen >= 32 {
+			if useHex && allHex && runLen >= minHex {
 				// Emit as hex match (without trailing =)
 				all = append(all, encodingMatch{
 					encoding: encodings[2], // hex
 					startEnd: startEnd{start, start + runLen},
 				})
-			} else if runLen >= 16 {
+			} else if piece, ok := findHexPiece(data[start:start+runLen], minHex); useHex && ok {
+				// Emit the hex part of the run (e.g. 0x7365... or key_7365...)
+				// and fall back to base64 for the whole run
+				m := encodingMatch{
+					encoding: encodings[2], // hex
+					startEnd: startEnd{start + piece.start, start + piece.end},
+				}
+				if useBase64 && runLen >= minB64 {
+					m.fallback = &encodingMatch{
+						encoding: encodings[3], // base64
+						startEnd: startEnd{start, end},
+					}
+				}
+				all = append(all, m)
+			} else if useBase64 && runLen >= minB64 {
 				// Emit as base64 match (include trailing =)
 				all = append(all, encodingMatch{
 					encoding: encodings[3], // base64
@@ -341,28 +759,5 @@ func findEncodingMatches(data string) []encodingMatch {
 		i++
 	}
 
-	totalMatches := len(all)
-	if totalMatches <= 1 {
-		return all
-	}
-
-	// filter out lower precedence ones that overlap their neighbors
-	filtered := make([]encodingMatch, 0, len(all))
-	for i, m := range all {
-		if i > 0 {
-			prev := all[i-1]
-			if m.overlaps(prev.startEnd) && prev.encoding.precedence > m.encoding.precedence {
-				continue // skip this one
-			}
-		}
-		if i+1 < totalMatches {
-			next := all[i+1]
-			if m.overlaps(next.startEnd) && next.encoding.precedence > m.encoding.precedence {
-				continue // skip this one
-			}
-		}
-		filtered = append(filtered, m)
-	}
-
-	return filtered
+	return all
 }
@@ -0,0 +1,183 @@
+package codec
+
+import (
+	"strings"
+)
+
+// Markers of the encrypted envelope formats
+const (
+	ansibleVaultHeader  = "$ANSIBLE_VAULT;"
+	sopsValuePrefix     = "ENC[AES256_GCM,"
+	ageArmorBegin       = "-----BEGIN AGE ENCRYPTED FILE-----"
+	ageArmorEnd         = "-----END AGE ENCRYPTED FILE-----"
+	sealedSecretKind    = "SealedSecret"
+	sealedSecretData    = "encryptedData"
+	sealedSecretPrefix  = "Ag"
+	minEncryptedB64Size = 64
+)
+
+// awsKMSPrefixes are the base64 of the version and key type bytes that
+// start AWS KMS ciphertext blobs
+var awsKMSPrefixes = []string{"AQICAH", "AQIDAH"}
+
+// encryptedEnvelope returns an opaque encoding for an encrypted envelope
+// format. There's nothing to decode without the key, so matches are only
+// tagged with the format.
+func encryptedEnvelope(format string, detect func(string) []startEnd) *encoding {
+	return &encoding{
+		kind:   encryptedKind,
+		detect: detectSpans(detect),
+		decode: func(encodedValue string, _ decodeConfig) []decodedPart {
+			return []decodedPart{{
+				value: encodedValue,
+				tags:  []string{"encrypted:" + format},
+			}}
+		},
+		precedence: 7,
+		opaque:     true,
+	}
+}
+
+// findAnsibleVaults matches Ansible Vault headers and the lines of hex that
+// follow them, which may be indented when they're inline in YAML
+func findAnsibleVaults(data string) []startEnd {
+	var matches []startEnd
+	for i := 0; i < len(data); {
+		start := strings.Index(data[i:], ansibleVaultHeader)
+		if start < 0 {
+			break
+		}
+		start += i
+
+		lineEnd := nextLineEnd(data, start)
+		end := -1
+		for next := lineEnd + 1; next < len(data); {
+			line := data[next:nextLineEnd(data, next)]
+			trimmed := strings.TrimSpace(line)
+			if len(trimmed) == 0 || hasByte(trimmed, isNotHexChar[:]) {
+				break
+			}
+			end = next + strings.Index(line, trimmed) + len(trimmed)
+			next += len(line) + 1
+		}
+
+		i = lineEnd
+		if end > 0 {
+			matches = append(matches, startEnd{start, end})
+			i = end
+		}
+	}
+
+	return matches
+}
+
+// nextLineEnd returns the index of the next newline from i or the end of the
+// data
+func nextLineEnd(data string, i int) int {
+	if end := strings.IndexByte(data[i:], '\n'); end >= 0 {
+		return i + end
+	}
+
+	return len(data)
+}
+
+// findSOPSValues matches the ENC[AES256_GCM,data:...,iv:...,tag:...,type:...]
+// values in SOPS encrypted files
+func findSOPSValues(data string) []startEnd {
+	var matches []startEnd
+	for i := 0; i < len(data); {
+		start := strings.Index(data[i:], sopsValuePrefix)
+		if start < 0 {
+			break
+		}
+		start += i
+
+		end := strings.IndexAny(data[start:], "]\n")
+		if end < 0 || data[start+end] != ']' {
+			i = start + len(sopsValuePrefix)
+			continue
+		}
+		end += start + 1
+
+		matches = append(matches, startEnd{start, end})
+		i = end
+	}
+
+	return matches
+}
+
+// findAgeArmor matches armored age encrypted files
+func findAgeArmor(data string) []startEnd {
+	var matches []startEnd
+	for i := 0; i < len(data); {
+		start := strings.Index(data[i:], ageArmorBegin)
+		if start < 0 {
+			break
+		}
+		start += i
+
+		end := strings.Index(data[start:], ageArmorEnd)
+		if end < 0 {
+			break
+		}
+		end += start + len(ageArmorEnd)
+
+		matches = append(matches, startEnd{start, end})
+		i = end
+	}
+
+	return matches
+}
+
+// findSealedSecrets matches the encrypted values of Kubernetes sealed
+// secrets. They're long base64 values that start with Ag after the
+// encryptedData key of a SealedSecret.
+func findSealedSecrets(data string) []startEnd {
+	if !strings.Contains(data, sealedSecretKind) {
+		return nil
+	}
+	dataStart := strings.Index(data, sealedSecretData)
+	if dataStart < 0 {
+		return nil
+	}
+
+	return findBase64Blobs(data, dataStart, sealedSecretPrefix)
+}
+
+// findAWSKMSCiphertexts matches base64 AWS KMS ciphertext blobs
+func findAWSKMSCiphertexts(data string) []startEnd {
+	var matches []startEnd
+	for _, prefix := range awsKMSPrefixes {
+		matches = append(matches, findBase64Blobs(data, 0, prefix)...)
+	}
+
+	return matches
+}
+
+// findBase64Blobs matches the base64 runs from i on that start with the
+// prefix and are at least minEncryptedB64Size long
+func findBase64Blobs(data string, i int, prefix string) []startEnd {
+	var matches []startEnd
+	for i < len(data) {
+		start := strings.Index(data[i:], prefix)
+		if start < 0 {
+			break
+		}
+		start += i
+
+		end := start + len(prefix)
+		for end < len(data) && (isB64Char[data[end]] || data[end] == '=') {
+			end++
+		}
+		i = end
+
+		if start > 0 && isB64Char[data[start-1]] {
+			continue
+		}
+		if end-start >= minEncryptedB64Size {
+			matches = append(matches, startEnd{start, end})
+		}
+	}
+
+	return matches
+}
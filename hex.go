@@ -1,5 +1,9 @@
 package codec
 
+import (
+	"strings"
+)
+
 // hexMap is a precalculated map of hex nibbles
 const hexMap = "" +
 	"\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff" +
@@ -19,6 +23,13 @@ const hexMap = "" +
 	"\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff" +
 	"\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff"
 
+// minHexLength is the fewest hex digits that are decoded
+const minHexLength = 32
+
+// minKeywordHexLength is the fewest hex digits that are decoded when they
+// follow a keyword
+const minKeywordHexLength = 8
+
 // likelyHexChars is a set of characters that you would expect to find at
 // least one of in hex encoded data. This risks missing some hex data that
 // doesn't contain these characters, but gives you the performance gain of not
@@ -31,30 +42,66 @@ func init() {
 	}
 }
 
-// decodeHex decodes hex data
-func decodeHex(encodedValue string) string {
+// decodeHex decodes hex encoded values the policy accepts or archives. 0x
+// prefixes and \x escapes are stripped, and odd length values are tried
+// without their last and then their first digit.
+func decodeHex(encodedValue string, config decodeConfig) []decodedPart {
+	// \x7365... or \x73\x65...
+	if strings.HasPrefix(encodedValue, `\x`) {
+		return decodeHexDigits(strings.ReplaceAll(encodedValue, `\x`, ""), config)
+	}
+
+	prefixLen := 0
+	if strings.HasPrefix(encodedValue, "0x") || strings.HasPrefix(encodedValue, "0X") {
+		prefixLen = 2
+	}
+
+	digits := encodedValue[prefixLen:]
+	if len(digits)%2 == 0 {
+		return decodeHexDigits(digits, config)
+	}
+
+	// Try to get back into alignment by dropping a digit from either end
 	size := len(encodedValue)
+	for _, span := range []startEnd{{0, size - 1}, {prefixLen + 1, size}} {
+		aligned := encodedValue[span.start:span.end]
+		if span.start == 0 {
+			aligned = aligned[prefixLen:]
+		}
+
+		parts := decodeHexDigits(aligned, config)
+		if len(parts) == 0 {
+			continue
+		}
+		for i := range parts {
+			parts[i].span = span
+		}
+		return parts
+	}
+
+	return nil
+}
+
+// decodeHexDigits decodes an even number of hex digits
+func decodeHexDigits(digits string, config decodeConfig) []decodedPart {
+	size := len(digits)
 	// hex should have two characters per byte
-	if size%2 != 0 {
-		return ""
+	if size == 0 || size%2 != 0 {
+		return nil
 	}
-	if !hasByte(encodedValue, likelyHexChars) {
-		return ""
+	if config.hexRequiresDigit && !hasByte(digits, likelyHexChars) {
+		return nil
 	}
 
 	decodedValue := make([]byte, size/2)
 	for i := 0; i < size; i += 2 {
-		n1 := hexMap[encodedValue[i]]
-		n2 := hexMap[encodedValue[i+1]]
+		n1 := hexMap[digits[i]]
+		n2 := hexMap[digits[i+1]]
 		if n1|n2 == '\xff' {
-			return ""
-		}
-		b := n1<<4 | n2
-		if !printableASCII[b] {
-			return ""
+			return nil
 		}
-		decodedValue[i/2] = b
+		decodedValue[i/2] = n1<<4 | n2
 	}
 
-	return string(decodedValue)
+	return decodeBytes(decodedValue, config)
 }
@@ -0,0 +1,281 @@
+package codec
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Limits of the hex dumps that are decoded
+const (
+	// minHexdumpLength is the fewest bytes a dump has to have
+	minHexdumpLength = 8
+	// maxHexdumpLength limits how far squeezed (*) lines are expanded
+	maxHexdumpLength = 16 << 20
+	// minHexdumpOffsetLength and maxHexdumpOffsetLength are the widths of
+	// offset columns
+	minHexdumpOffsetLength = 4
+	maxHexdumpOffsetLength = 16
+	// hexdumpHalfLine is the number of single byte columns hexdump -C puts
+	// before the extra space in the middle of a line
+	hexdumpHalfLine = 8
+	// odOctalWordLength is the width of the octal 16 bit words od prints by
+	// default. No hex dump has columns this wide.
+	odOctalWordLength = 6
+)
+
+// hexdumpLine is a line of an xxd, hexdump or od dump
+type hexdumpLine struct {
+	// offset is the offset column as hex and octal since od defaults to
+	// octal offsets
+	offset      uint64
+	octalOffset uint64
+	isOctal     bool
+	// colon is true for the offset: columns of xxd
+	colon bool
+	// width is the number of digits in each column, which are octal for
+	// columns that are odOctalWordLength wide
+	width int
+	// bytes are the bytes of the columns, which are 16 and 32 bit little
+	// endian words for hexdump and od without a colon
+	bytes []byte
+	// partial is true if the last column was short, which only happens at
+	// the end of an xxd dump
+	partial bool
+	// end is the end of the line without trailing whitespace and next is
+	// the start of the next line
+	end  int
+	next int
+}
+
+// columnSize returns the number of bytes in each column of the line
+func (l hexdumpLine) columnSize() int {
+	if l.width == odOctalWordLength {
+		return 2
+	}
+
+	return l.width / 2
+}
+
+// findHexdumps matches xxd, hexdump and od dumps, including the octal words
+// od prints by default, from the offset of their first line through the end
+// of their last line
+func findHexdumps(data string) []startEnd {
+	var matches []startEnd
+	for i := 0; i < len(data); i = nextLineEnd(data, i) + 1 {
+		start := i
+		for start < len(data) && (data[start] == ' ' || data[start] == '\t') {
+			start++
+		}
+		if start == len(data) || !isHexChar[data[start]] {
+			continue
+		}
+
+		if end, _, ok := readHexdump(data, start); ok {
+			matches = append(matches, startEnd{start, end})
+			i = end
+		}
+	}
+
+	return matches
+}
+
+// decodeHexdump joins the columns of a dump and decodes the bytes
+func decodeHexdump(encodedValue string, config decodeConfig) []decodedPart {
+	_, decoded, ok := readHexdump(encodedValue, 0)
+	if !ok {
+		return nil
+	}
+
+	return decodeBytes(decoded, config)
+}
+
+// readHexdump reads the dump at start and returns where it ends and its
+// bytes. The offsets of each line have to line up with the bytes before
+// them, which is what tells dumps apart from tables of numbers. Single line
+// dumps are only read from xxd since it marks the offset with a colon.
+func readHexdump(data string, start int) (int, []byte, bool) {
+	first, ok := parseHexdumpLine(data, start)
+	if !ok || len(first.bytes) == 0 {
+		return 0, nil, false
+	}
+
+	decoded := first.bytes
+	previous := first
+	end, next := first.end, first.next
+	lines := 1
+	squeezed := false
+	for !previous.partial && next < len(data) {
+		if strings.TrimSpace(data[next:nextLineEnd(data, next)]) == "*" {
+			// hexdump and od replace repeated lines with a *
+			squeezed = true
+			next = nextLineEnd(data, next) + 1
+			continue
+		}
+
+		line, ok := parseHexdumpLine(data, next)
+		if !ok || line.colon != first.colon || (len(line.bytes) != 0 && line.width != first.width) {
+			break
+		}
+
+		size, ok := hexdumpDistance(first, line, len(decoded), len(previous.bytes), squeezed)
+		if !ok {
+			break
+		}
+		for squeezed && len(decoded) < size {
+			decoded = append(decoded, previous.bytes...)
+		}
+		if len(line.bytes) == 0 {
+			// The last line of hexdump and od is the size of the dump,
+			// which trims the padding of the last word
+			decoded = decoded[:size]
+			end = line.end
+			lines++
+			break
+		}
+
+		decoded = append(decoded, line.bytes...)
+		previous = line
+		end, next = line.end, line.next
+		lines++
+		squeezed = false
+	}
+
+	if (lines < 2 && !first.colon) || len(decoded) < minHexdumpLength {
+		return 0, nil, false
+	}
+
+	return end, decoded, true
+}
+
+// hexdumpDistance returns the number of bytes between the first line and
+// the line by their offsets if it matches the bytes read so far. The offsets
+// are tried as hex and then octal.
+func hexdumpDistance(first, line hexdumpLine, size, lineSize int, squeezed bool) (int, bool) {
+	candidates := []uint64{line.offset - first.offset}
+	if first.isOctal && line.isOctal {
+		candidates = append(candidates, line.octalOffset-first.octalOffset)
+	}
+
+	for _, distance := range candidates {
+		if distance > maxHexdumpLength {
+			continue
+		}
+		d := int(distance)
+		switch {
+		case squeezed:
+			if d >= size && lineSize > 0 && (d-size)%lineSize == 0 {
+				return d, true
+			}
+		case len(line.bytes) == 0:
+			if d <= size && d > size-first.columnSize() {
+				return d, true
+			}
+		case d == size:
+			return d, true
+		}
+	}
+
+	return 0, false
+}
+
+// parseHexdumpLine parses the offset and columns of the line at start. The
+// columns end at a gap of two or more spaces, or a token that isn't a
+// column, so the ASCII gutter is ignored.
+func parseHexdumpLine(data string, start int) (hexdumpLine, bool) {
+	var line hexdumpLine
+	lineEnd := nextLineEnd(data, start)
+	line.next = lineEnd + 1
+	line.end = lineEnd
+	for line.end > start && isWhitespace[data[line.end-1]] {
+		line.end--
+	}
+
+	i := start
+	for i < line.end && (data[i] == ' ' || data[i] == '\t') {
+		i++
+	}
+	offsetStart := i
+	for i < line.end && isHexChar[data[i]] {
+		i++
+	}
+	offset := data[offsetStart:i]
+	if len(offset) < minHexdumpOffsetLength || len(offset) > maxHexdumpOffsetLength {
+		return line, false
+	}
+	line.offset, _ = strconv.ParseUint(offset, 16, 64)
+	octalOffset, err := strconv.ParseUint(offset, 8, 64)
+	line.octalOffset, line.isOctal = octalOffset, err == nil
+
+	if i < line.end && data[i] == ':' {
+		line.colon = true
+		i++
+	}
+	if i < line.end && data[i] != ' ' && data[i] != '\t' {
+		return line, false
+	}
+
+	columns := 0
+	for i < line.end {
+		gap := i
+		for i < line.end && data[i] == ' ' {
+			i++
+		}
+		gap = i - gap
+		if columns > 0 && gap > 1 && !(gap == 2 && line.width == 2 && !line.colon && columns == hexdumpHalfLine) {
+			break
+		}
+
+		token := i
+		for i < line.end && !isWhitespace[data[i]] {
+			i++
+		}
+		column := data[token:i]
+		if len(column) == 0 || len(column)%2 == 1 || hasByte(column, isNotHexChar[:]) {
+			break
+		}
+		if line.width == 0 {
+			line.width = len(column)
+		}
+		if len(column) > line.width {
+			break
+		}
+
+		if line.width == odOctalWordLength {
+			word, err := strconv.ParseUint(column, 8, 16)
+			if err != nil || line.colon || len(column) < line.width {
+				break
+			}
+			line.bytes = append(line.bytes, byte(word), byte(word>>8))
+			columns++
+			continue
+		}
+		line.bytes = appendHexdumpColumn(line.bytes, column, !line.colon)
+		columns++
+		if len(column) < line.width {
+			line.partial = true
+			break
+		}
+	}
+	if columns == 0 && i < line.end {
+		return line, false
+	}
+
+	return line, true
+}
+
+// appendHexdumpColumn appends the bytes of a column, reversing the words of
+// little endian dumps
+func appendHexdumpColumn(decoded []byte, column string, littleEndian bool) []byte {
+	size := len(decoded)
+	for i := 0; i < len(column); i += 2 {
+		decoded = append(decoded, hexMap[column[i]]<<4|hexMap[column[i+1]])
+	}
+	if littleEndian {
+		word := decoded[size:]
+		for i, j := 0, len(word)-1; i < j; i, j = i+1, j-1 {
+			word[i], word[j] = word[j], word[i]
+		}
+	}
+
+	return decoded
+}
@@ -0,0 +1,69 @@
+package codec
+
+import (
+	"strings"
+)
+
+// DefaultKeywords are sensitive keywords that can be used for
+// Decoder.Keywords
+var DefaultKeywords = []string{"password", "passwd", "secret", "token", "key"}
+
+// defaultKeywordDistance is how many bytes can be between a keyword and a
+// run by default. It leaves room for things like `": "` and ` = '`.
+const defaultKeywordDistance = 16
+
+// followsKeyword returns true if the run at start is close enough after one
+// of the keywords to use the lower minimum lengths
+func (d *Decoder) followsKeyword(data string, start int) bool {
+	if len(d.Keywords) == 0 {
+		return false
+	}
+
+	distance := d.KeywordDistance
+	if distance <= 0 {
+		distance = defaultKeywordDistance
+	}
+
+	for _, keyword := range d.Keywords {
+		if len(keyword) == 0 {
+			continue
+		}
+		// Any keyword that ends in the window is close enough
+		from := max(0, start-distance-len(keyword))
+		for j := start - len(keyword); j >= from; j-- {
+			if strings.EqualFold(data[j:j+len(keyword)], keyword) && isKeywordWord(data, j, j+len(keyword)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isKeywordWord returns true if the keyword match is a whole word of an
+// identifier, so key matches DB_KEY and apiKey but not monkey or keyboard
+func isKeywordWord(data string, start, end int) bool {
+	if start > 0 && isWordChar(data[start-1]) && !(isLower(data[start-1]) && isUpper(data[start])) {
+		return false
+	}
+	if end < len(data) && isWordChar(data[end]) && !(isLower(data[end-1]) && isUpper(data[end])) {
+		return false
+	}
+
+	return true
+}
+
+// isWordChar returns true for the ASCII letters and digits
+func isWordChar(c byte) bool {
+	return isLower(c) || isUpper(c) || ('0' <= c && c <= '9')
+}
+
+// isLower returns true for the lowercase ASCII letters
+func isLower(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
+
+// isUpper returns true for the uppercase ASCII letters
+func isUpper(c byte) bool {
+	return 'A' <= c && c <= 'Z'
+}
@@ -0,0 +1,127 @@
+package codec
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// kindNames maps the encodingKinds to their names in kind order. It's shared
+// by all decoders so a custom encoding has the same kind in each decoder it's
+// registered with.
+var kindNames = struct {
+	sync.RWMutex
+	names []string
+}{
+	names: []string{
+		"percent",
+		"unicode",
+		"hex",
+		"base64",
+		"pdf",
+		"ooxml",
+		"base64url",
+		"form",
+		"base45",
+		"pgp",
+		"ssh",
+		"cookie",
+		"encrypted",
+		"hexdump",
+		"binary",
+		"decimal",
+		"reg",
+		"normalized",
+		"confusable",
+	},
+}
+
+// kindByName returns the kind with the name, adding a new kind for names
+// that haven't been seen before
+func kindByName(name string) encodingKind {
+	kindNames.Lock()
+	defer kindNames.Unlock()
+
+	for i, n := range kindNames.names {
+		if n == name {
+			return encodingKind(i + 1)
+		}
+	}
+
+	kindNames.names = append(kindNames.names, name)
+	return encodingKind(len(kindNames.names))
+}
+
+// lookupKind returns the kind with the name without adding a new kind for
+// names that haven't been seen before
+func lookupKind(name string) (encodingKind, bool) {
+	kindNames.RLock()
+	defer kindNames.RUnlock()
+
+	for i, n := range kindNames.names {
+		if n == name {
+			return encodingKind(i + 1), true
+		}
+	}
+
+	return 0, false
+}
+
+// kindSet is a set of encodingKinds. Segments use it to keep track of all of
+// the encodings that went into them.
+type kindSet []uint64
+
+// newKindSet returns a set with the kinds in it
+func newKindSet(kinds ...encodingKind) kindSet {
+	var s kindSet
+	for _, kind := range kinds {
+		s = s.add(kind)
+	}
+
+	return s
+}
+
+// add adds the kind to the set and returns the set, which may have grown
+func (s kindSet) add(kind encodingKind) kindSet {
+	word, bit := int(kind)/64, uint(kind)%64
+	for len(s) <= word {
+		s = append(s, 0)
+	}
+	s[word] |= 1 << bit
+
+	return s
+}
+
+// union adds the kinds in o to the set and returns the set. The set is
+// copied first if it has to grow so that o is never shared.
+func (s kindSet) union(o kindSet) kindSet {
+	if len(s) < len(o) {
+		grown := make(kindSet, len(o))
+		copy(grown, s)
+		s = grown
+	}
+	for i, word := range o {
+		s[i] |= word
+	}
+
+	return s
+}
+
+// kinds returns the kinds in the set in kind order
+func (s kindSet) kinds() []encodingKind {
+	kinds := []encodingKind{}
+	for i, word := range s {
+		for word != 0 {
+			bit := bits.TrailingZeros64(word)
+			kinds = append(kinds, encodingKind(i*64+bit))
+			word &^= 1 << bit
+		}
+	}
+
+	return kinds
+}
+
+// has returns true if the kind is in the set
+func (s kindSet) has(kind encodingKind) bool {
+	word, bit := int(kind)/64, uint(kind)%64
+	return word < len(s) && s[word]&(1<<bit) != 0
+}
@@ -0,0 +1,156 @@
+package codec
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Categories of the characters that normalization removes or folds. They're
+// used in the tags of normalized segments.
+const (
+	removedZeroWidth = "removed:zero-width"
+	removedBidi      = "removed:bidi"
+	foldedFullwidth  = "folded:fullwidth"
+	foldedCompatible = "folded:compatibility"
+)
+
+// compatibilityFolds are hand-picked characters with compatibility
+// decompositions that show up in text meant to look like ASCII, folded to
+// what those decompositions give. It's not full Unicode normalization. The
+// ones in ranges (e.g. mathematical letters) are handled in normalizeRune.
+var compatibilityFolds = map[rune]string{
+	// Spaces
+	'\u00a0': " ", '\u202f': " ", '\u205f': " ",
+	// Ligatures
+	'\ufb00': "ff", '\ufb01': "fi", '\ufb02': "fl", '\ufb03': "ffi", '\ufb04': "ffl",
+	'\ufb05': "st", '\ufb06': "st",
+	// Superscripts
+	'\u00b9': "1", '\u00b2': "2", '\u00b3': "3", '\u2070': "0", '\u2071': "i",
+	'\u207f': "n",
+	// Dot leaders
+	'\u2024': ".", '\u2025': "..", '\u2026': "...",
+	// Letterlike symbols
+	'\u2102': "C", '\u210d': "H", '\u2115': "N", '\u2119': "P", '\u211a': "Q",
+	'\u211d': "R", '\u2124': "Z", '\u212a': "K",
+}
+
+// normalizeRune returns what a rune normalizes to and its category. It
+// returns false for runes that are left alone.
+func normalizeRune(r rune) (string, string, bool) {
+	switch {
+	case r < utf8.RuneSelf:
+		return "", "", false
+	// Zero width spaces and joiners, word joiner, BOM, soft hyphen and
+	// Mongolian vowel separator
+	case r >= '\u200b' && r <= '\u200d', r == '\u2060', r == '\ufeff', r == '\u00ad', r == '\u180e':
+		return "", removedZeroWidth, true
+	// Direction marks, embeddings, overrides and isolates
+	case r == '\u200e', r == '\u200f', r == '\u061c', r >= '\u202a' && r <= '\u202e', r >= '\u2066' && r <= '\u2069':
+		return "", removedBidi, true
+	case r >= '\uff01' && r <= '\uff5e':
+		return string(r - 0xfee0), foldedFullwidth, true
+	case r == '\u3000':
+		return " ", foldedFullwidth, true
+	case r >= '\u2000' && r <= '\u200a':
+		return " ", foldedCompatible, true
+	case r >= '\u2074' && r <= '\u2079':
+		return string('4' + r - '\u2074'), foldedCompatible, true
+	case r >= '\u2080' && r <= '\u2089':
+		return string('0' + r - '\u2080'), foldedCompatible, true
+	case r >= '\u2460' && r <= '\u2468':
+		return string('1' + r - '\u2460'), foldedCompatible, true
+	case r >= '\u24b6' && r <= '\u24cf':
+		return string('A' + r - '\u24b6'), foldedCompatible, true
+	case r >= '\u24d0' && r <= '\u24e9':
+		return string('a' + r - '\u24d0'), foldedCompatible, true
+	case r == '\u24ea':
+		return "0", foldedCompatible, true
+	case r >= 0x1d400 && r <= 0x1d6a3:
+		// Mathematical alphanumerics are the alphabet in 52 letter styles
+		i := (r - 0x1d400) % 52
+		if i < 26 {
+			return string('A' + i), foldedCompatible, true
+		}
+		return string('a' + i - 26), foldedCompatible, true
+	case r >= 0x1d7ce && r <= 0x1d7ff:
+		return string('0' + (r-0x1d7ce)%10), foldedCompatible, true
+	}
+
+	if folded, ok := compatibilityFolds[r]; ok {
+		return folded, foldedCompatible, true
+	}
+
+	return "", "", false
+}
+
+// findNormalizable matches the words that have invisible, bidi, fullwidth
+// or compatibility characters in them. Matching whole words lets the rest
+// of the word be decoded with them in the next pass.
+func findNormalizable(data string) []startEnd {
+	var matches []startEnd
+	for i := 0; i < len(data); {
+		if data[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(data[i:])
+		if _, _, ok := normalizeRune(r); !ok {
+			i += size
+			continue
+		}
+
+		start, end := i, i+size
+		for start > 0 && !isWhitespace[data[start-1]] {
+			start--
+		}
+		for end < len(data) && !isWhitespace[data[end]] {
+			end++
+		}
+
+		matches = append(matches, startEnd{start, end})
+		i = end
+	}
+
+	return matches
+}
+
+// decodeNormalizable folds the characters of a word to ASCII where
+// possible and removes the invisible ones. What was removed or folded is in
+// the tags.
+func decodeNormalizable(encodedValue string, _ decodeConfig) []decodedPart {
+	return foldRunes(encodedValue, normalizeRune)
+}
+
+// foldRunes replaces the runes that fold returns true for and tags the part
+// with their categories. The offset map points each byte back at the rune
+// it came from. Words that fold to nothing (e.g. only zero width spaces) are
+// left alone since an empty segment has no line to be on.
+func foldRunes(encodedValue string, fold func(rune) (string, string, bool)) []decodedPart {
+	var folded strings.Builder
+	folded.Grow(len(encodedValue))
+	offsets := make([]int, 0, len(encodedValue)+1)
+	var tags []string
+
+	for i := 0; i < len(encodedValue); {
+		r, size := utf8.DecodeRuneInString(encodedValue[i:])
+		value, category, ok := fold(r)
+		if !ok {
+			value = encodedValue[i : i+size]
+		} else if category != "" {
+			tags = appendUnique(tags, category)
+		}
+
+		for j := 0; j < len(value); j++ {
+			offsets = append(offsets, i)
+		}
+		folded.WriteString(value)
+		i += size
+	}
+	if folded.Len() == 0 || (folded.Len() == len(encodedValue) && folded.String() == encodedValue) {
+		return nil
+	}
+	offsets = append(offsets, len(encodedValue))
+
+	return []decodedPart{{value: folded.String(), tags: tags, offsets: offsets}}
+}
@@ -0,0 +1,307 @@
+package codec
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ooxmlContentTypes is the part that every Office Open XML package has
+const ooxmlContentTypes = "[Content_Types].xml"
+
+// Office Open XML parts that text is pulled from
+const (
+	ooxmlDocument      = "word/document.xml"
+	ooxmlSharedStrings = "xl/sharedStrings.xml"
+	ooxmlWorksheets    = "xl/worksheets/"
+	ooxmlSlides        = "ppt/slides/"
+)
+
+// findOOXMLPackage matches data that is an Office Open XML package (e.g. a
+// committed docx, xlsx or pptx file)
+func findOOXMLPackage(data string) []startEnd {
+	if !strings.HasPrefix(data, string(zipMagic)) || !strings.Contains(data, ooxmlContentTypes) {
+		return nil
+	}
+
+	return []startEnd{{0, len(data)}}
+}
+
+// decodeOOXMLPackage returns the text in an Office Open XML package
+func decodeOOXMLPackage(encodedValue string, config decodeConfig) []decodedPart {
+	reader, err := zip.NewReader(strings.NewReader(encodedValue), int64(len(encodedValue)))
+	if err != nil || !isOOXML(reader) {
+		return nil
+	}
+
+	return decodeOOXML(reader, config.accept)
+}
+
+// isOOXML returns true if the zip archive is an Office Open XML package
+func isOOXML(reader *zip.Reader) bool {
+	for _, f := range reader.File {
+		if f.Name == ooxmlContentTypes {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isOOXMLPart returns true if the name is a part directly under dir
+func isOOXMLPart(name, dir string) bool {
+	return strings.HasPrefix(name, dir) &&
+		strings.HasSuffix(name, ".xml") &&
+		!strings.Contains(name[len(dir):], "/")
+}
+
+// decodeOOXML returns a part for each paragraph in the document and slides
+// and each string cell in the worksheets. Each part is tagged with the name
+// of the package part it came from and its location in it.
+func decodeOOXML(reader *zip.Reader, accept AcceptPolicy) []decodedPart {
+	parts := []decodedPart{}
+	sharedStrings := []string{}
+	worksheets := []*zip.File{}
+	remaining := int64(maxArchiveSize)
+
+	for i, f := range reader.File {
+		if i >= maxArchiveEntries {
+			break
+		}
+
+		switch {
+		case f.Name == ooxmlDocument, isOOXMLPart(f.Name, ooxmlSlides):
+			content, err := readZipFile(f, &remaining)
+			if errors.Is(err, errArchiveTooLarge) {
+				return parts
+			}
+			if err == nil {
+				parts = append(parts, ooxmlParagraphs(f.Name, content, accept)...)
+			}
+		case f.Name == ooxmlSharedStrings:
+			content, err := readZipFile(f, &remaining)
+			if errors.Is(err, errArchiveTooLarge) {
+				return parts
+			}
+			if err == nil {
+				sharedStrings = ooxmlStrings(content)
+			}
+		case isOOXMLPart(f.Name, ooxmlWorksheets):
+			// Worksheets reference the shared strings so they're read last
+			worksheets = append(worksheets, f)
+		}
+	}
+
+	referenced := make([]bool, len(sharedStrings))
+	for _, f := range worksheets {
+		content, err := readZipFile(f, &remaining)
+		if errors.Is(err, errArchiveTooLarge) {
+			return parts
+		}
+		if err == nil {
+			parts = append(parts, ooxmlCells(f.Name, content, sharedStrings, referenced, accept)...)
+		}
+	}
+
+	// Shared strings that no cell uses could still hold something
+	for i, s := range sharedStrings {
+		if !referenced[i] {
+			parts = appendOOXMLPart(parts, s, ooxmlSharedStrings, "ooxml-string:"+strconv.Itoa(i), accept)
+		}
+	}
+
+	return parts
+}
+
+// appendOOXMLPart appends a part for the text if the policy accepts it
+func appendOOXMLPart(parts []decodedPart, text, name, location string, accept AcceptPolicy) []decodedPart {
+	if len(strings.TrimSpace(text)) == 0 || !accept([]byte(text)) {
+		return parts
+	}
+
+	return append(parts, decodedPart{
+		value: text,
+		tags: []string{
+			"ooxml-part:" + name,
+			location,
+		},
+	})
+}
+
+// ooxmlParagraphs returns a part for each paragraph (w:p or a:p) in a
+// document or slide. Paragraphs are numbered from 1 in document order.
+func ooxmlParagraphs(name string, content []byte, accept AcceptPolicy) []decodedPart {
+	type paragraph struct {
+		number int
+		text   strings.Builder
+	}
+
+	parts := []decodedPart{}
+	stack := []*paragraph{}
+	count := 0
+	inText := 0
+
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				count++
+				stack = append(stack, &paragraph{number: count})
+			case "t":
+				inText++
+			case "tab":
+				if len(stack) > 0 {
+					stack[len(stack)-1].text.WriteByte('\t')
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				if len(stack) == 0 {
+					continue
+				}
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				parts = appendOOXMLPart(parts, p.text.String(), name, "ooxml-paragraph:"+strconv.Itoa(p.number), accept)
+			case "t":
+				inText--
+			}
+		case xml.CharData:
+			if inText > 0 && len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+
+	return parts
+}
+
+// ooxmlStrings returns the strings in the shared string table. Phonetic
+// runs (rPh) are skipped since they repeat the text they annotate.
+func ooxmlStrings(content []byte) []string {
+	strs := []string{}
+	var text strings.Builder
+	inItem := false
+	inText := 0
+	inPhonetic := 0
+
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				inItem = true
+				text.Reset()
+			case "t":
+				inText++
+			case "rPh":
+				inPhonetic++
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				inItem = false
+				strs = append(strs, text.String())
+			case "t":
+				inText--
+			case "rPh":
+				inPhonetic--
+			}
+		case xml.CharData:
+			if inItem && inText > 0 && inPhonetic == 0 {
+				text.Write(t)
+			}
+		}
+	}
+
+	return strs
+}
+
+// ooxmlCells returns a part for each string cell in a worksheet. Shared
+// string cells are looked up in sharedStrings and marked as referenced.
+func ooxmlCells(name string, content []byte, sharedStrings []string, referenced []bool, accept AcceptPolicy) []decodedPart {
+	parts := []decodedPart{}
+	var ref, cellType string
+	var value, inline strings.Builder
+	inValue := false
+	inText := 0
+
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "c":
+				ref, cellType = "", ""
+				for _, attr := range t.Attr {
+					switch attr.Name.Local {
+					case "r":
+						ref = attr.Value
+					case "t":
+						cellType = attr.Value
+					}
+				}
+				value.Reset()
+				inline.Reset()
+			case "v":
+				inValue = true
+			case "t":
+				inText++
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "c":
+				var text string
+				switch cellType {
+				case "s":
+					i, err := strconv.Atoi(strings.TrimSpace(value.String()))
+					if err != nil || i < 0 || i >= len(sharedStrings) {
+						continue
+					}
+					referenced[i] = true
+					text = sharedStrings[i]
+				case "inlineStr":
+					text = inline.String()
+				case "str":
+					text = value.String()
+				default:
+					continue // numbers, booleans and errors
+				}
+				parts = appendOOXMLPart(parts, text, name, "ooxml-cell:"+ref, accept)
+			case "v":
+				inValue = false
+			case "t":
+				inText--
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			} else if inText > 0 {
+				inline.Write(t)
+			}
+		}
+	}
+
+	return parts
+}
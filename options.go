@@ -0,0 +1,274 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Option configures a Decoder created with NewDecoder. Options only set the
+// decoder's fields, so Validate checks them like fields set directly.
+type Option func(*Decoder)
+
+// Heuristic is a cheap check that skips values that are unlikely to be
+// encoded before trying to decode them
+type Heuristic int
+
+const (
+	// LikelyBase64Chars skips base64 values without a digit, +, /, - or _
+	// in them
+	LikelyBase64Chars Heuristic = 1 << iota
+	// LikelyHexChars skips hex values without a digit in them. Very little
+	// hex encoded text is all letters, so this avoids decoding a lot of
+	// words made of a-f.
+	LikelyHexChars
+
+	// allHeuristics are all of the heuristics, which are used by default
+	allHeuristics = LikelyBase64Chars | LikelyHexChars
+)
+
+// WithPolicy sets Decoder.Policy
+func WithPolicy(accept AcceptPolicy) Option {
+	return func(d *Decoder) {
+		d.Policy = accept
+	}
+}
+
+// WithEncodingPolicy adds the policy for the encoding with the name to
+// Decoder.EncodingPolicies
+func WithEncodingPolicy(name string, accept AcceptPolicy) Option {
+	return func(d *Decoder) {
+		if d.EncodingPolicies == nil {
+			d.EncodingPolicies = make(map[string]AcceptPolicy)
+		}
+		d.EncodingPolicies[name] = accept
+	}
+}
+
+// WithStrictPercent sets Decoder.StrictPercent
+func WithStrictPercent() Option {
+	return func(d *Decoder) {
+		d.StrictPercent = true
+	}
+}
+
+// WithKeywords sets Decoder.Keywords
+func WithKeywords(keywords ...string) Option {
+	return func(d *Decoder) {
+		d.Keywords = keywords
+	}
+}
+
+// WithKeywordDistance sets Decoder.KeywordDistance
+func WithKeywordDistance(n int) Option {
+	return func(d *Decoder) {
+		d.KeywordDistance = n
+	}
+}
+
+// WithDeobfuscate sets Decoder.Deobfuscate and Decoder.DeobfuscateThreshold.
+// The default threshold is used when it's 0.
+func WithDeobfuscate(threshold float64) Option {
+	return func(d *Decoder) {
+		d.Deobfuscate = true
+		d.DeobfuscateThreshold = threshold
+	}
+}
+
+// WithMinByteSequenceLength sets Decoder.MinByteSequenceLength
+func WithMinByteSequenceLength(n int) Option {
+	return func(d *Decoder) {
+		d.MinByteSequenceLength = n
+	}
+}
+
+// WithCharsets sets Decoder.Charsets
+func WithCharsets(names ...string) Option {
+	return func(d *Decoder) {
+		d.Charsets = names
+	}
+}
+
+// WithNormalize sets Decoder.Normalize
+func WithNormalize() Option {
+	return func(d *Decoder) {
+		d.Normalize = true
+	}
+}
+
+// WithFoldConfusables sets Decoder.FoldConfusables
+func WithFoldConfusables() Option {
+	return func(d *Decoder) {
+		d.FoldConfusables = true
+	}
+}
+
+// WithEncodings sets Decoder.Encodings
+func WithEncodings(names ...string) Option {
+	return func(d *Decoder) {
+		d.Encodings = append([]string{}, names...)
+	}
+}
+
+// WithMinLength adds the minimum for the encoding with the name to
+// Decoder.MinLengths
+func WithMinLength(name string, n int) Option {
+	return func(d *Decoder) {
+		if d.MinLengths == nil {
+			d.MinLengths = make(map[string]int)
+		}
+		d.MinLengths[name] = n
+	}
+}
+
+// WithMaxDepth sets Decoder.MaxDepth
+func WithMaxDepth(n int) Option {
+	return func(d *Decoder) {
+		d.MaxDepth = n
+	}
+}
+
+// WithHeuristics only uses the heuristics listed by setting
+// Decoder.DisabledHeuristics to the rest. None are used when it's called
+// without any.
+func WithHeuristics(heuristics ...Heuristic) Option {
+	return func(d *Decoder) {
+		var enabled Heuristic
+		for _, h := range heuristics {
+			enabled |= h
+		}
+		d.DisabledHeuristics = allHeuristics &^ enabled
+	}
+}
+
+// Validate returns an error for each encoding or charset name in the
+// decoder's fields that is neither built in nor registered with the decoder.
+// Unknown names are ignored when decoding, so call it once the custom
+// encodings are registered to keep a typo from silently turning a setting
+// off.
+func (d *Decoder) Validate() error {
+	var errs []error
+	for _, name := range d.Encodings {
+		if !d.hasEncoding(name) {
+			errs = append(errs, fmt.Errorf("unknown encoding %q in Encodings", name))
+		}
+	}
+	for _, name := range sortedKeys(d.MinLengths) {
+		if !d.hasEncoding(name) {
+			errs = append(errs, fmt.Errorf("unknown encoding %q in MinLengths", name))
+		}
+	}
+	for _, name := range sortedKeys(d.EncodingPolicies) {
+		if !d.hasEncoding(name) {
+			errs = append(errs, fmt.Errorf("unknown encoding %q in EncodingPolicies", name))
+		}
+	}
+	for _, name := range d.Charsets {
+		if _, ok := charsets[strings.ToLower(name)]; !ok {
+			errs = append(errs, fmt.Errorf("unknown charset %q in Charsets", name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// sortedKeys returns the keys of the map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// hasEncoding returns true if the name is a built in encoding or one
+// registered with the decoder
+func (d *Decoder) hasEncoding(name string) bool {
+	kind, ok := lookupKind(name)
+	if !ok {
+		return false
+	}
+	if kind <= lastBuiltInKind {
+		return true
+	}
+	for _, e := range d.custom {
+		if e.kind == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// uses returns true if the decoder decodes the encoding
+func (d *Decoder) uses(e *encoding) bool {
+	if e.enabled != nil && !e.enabled(d) {
+		return false
+	}
+	// The parts of encodings without a kind are checked by usedParts
+	if e.kind == 0 {
+		return true
+	}
+
+	return d.usesKind(e.kind)
+}
+
+// usesKind returns true if the kind is one of the decoder's encodings
+func (d *Decoder) usesKind(kind encodingKind) bool {
+	if d.Encodings == nil {
+		return true
+	}
+	// The scanner's base64 matches are reported as base64url when they use
+	// that alphabet
+	if kind == base64Kind && slices.Contains(d.Encodings, base64URLKind.String()) {
+		return true
+	}
+
+	return slices.Contains(d.Encodings, kind.String())
+}
+
+// minLength returns the fewest characters a value of the kind needs, or
+// defaultLength if Decoder.MinLengths doesn't have it
+func (d *Decoder) minLength(kind encodingKind, defaultLength int) int {
+	if n, ok := d.MinLengths[kind.String()]; ok {
+		return n
+	}
+
+	return defaultLength
+}
+
+// longEnough returns true if the match meets the minimum length set for its
+// encoding. Hex and base64 runs are checked by the scanner instead since
+// keywords lower their minimums.
+func (d *Decoder) longEnough(m encodingMatch) bool {
+	if m.encoding.kind == hexKind || m.encoding.kind == base64Kind {
+		return true
+	}
+
+	return m.end-m.start >= d.minLength(m.encoding.kind, 0)
+}
+
+// usedParts returns the decoded parts whose kinds the decoder uses. Parts
+// can have a different kind than their encoding (e.g. base64url).
+func (d *Decoder) usedParts(parts []decodedPart, kind encodingKind) []decodedPart {
+	if d.Encodings == nil {
+		return parts
+	}
+
+	var used []decodedPart
+	for _, part := range parts {
+		partKind := kind
+		if part.kind != 0 {
+			partKind = part.kind
+		}
+		if slices.Contains(d.Encodings, partKind.String()) {
+			used = append(used, part)
+		}
+	}
+
+	return used
+}
@@ -0,0 +1,398 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/ascii85"
+	"errors"
+	"strings"
+)
+
+// pdfHeaderWindow is how far into the data the %PDF- header can be. The
+// spec allows junk before the header as long as it's within the first 1024
+// bytes.
+const pdfHeaderWindow = 1024
+
+// errInvalidPDFHex is returned when ASCIIHexDecode data has a non-hex digit
+var errInvalidPDFHex = errors.New("invalid hex digit")
+
+// isPDFDelimiter is a lookup table of the PDF delimiter characters
+var isPDFDelimiter [256]bool
+
+func init() {
+	for _, c := range `()<>[]{}/%` {
+		isPDFDelimiter[c] = true
+	}
+}
+
+// isPDF returns true if the data has a PDF header
+func isPDF(data string) bool {
+	return strings.Contains(data[:min(len(data), pdfHeaderWindow)], "%PDF-")
+}
+
+// findPDFStreams finds the stream objects in a PDF. Each match spans from the
+// start of the stream's dictionary to the end of the endstream keyword.
+func findPDFStreams(data string) []startEnd {
+	if !isPDF(data) {
+		return nil
+	}
+
+	streams := []startEnd{}
+	i := 0
+	for {
+		k := strings.Index(data[i:], "stream")
+		if k < 0 {
+			break
+		}
+		keyword := i + k
+		i = keyword + len("stream")
+
+		// Skip endstream keywords
+		if keyword >= 3 && data[keyword-3:keyword] == "end" {
+			continue
+		}
+
+		// The keyword must be followed by an end of line
+		dataStart := i
+		switch {
+		case strings.HasPrefix(data[dataStart:], "\r\n"):
+			dataStart += 2
+		case dataStart < len(data) && (data[dataStart] == '\n' || data[dataStart] == '\r'):
+			dataStart++
+		default:
+			continue
+		}
+
+		// The keyword must come right after the stream's dictionary
+		dictStart := findPDFDictStart(data, keyword)
+		if dictStart < 0 || (len(streams) > 0 && dictStart < streams[len(streams)-1].end) {
+			continue
+		}
+
+		dataEnd := strings.Index(data[dataStart:], "endstream")
+		if dataEnd < 0 {
+			break
+		}
+
+		end := dataStart + dataEnd + len("endstream")
+		streams = append(streams, startEnd{dictStart, end})
+		i = end
+	}
+
+	return streams
+}
+
+// findPDFDictStart returns the start of the dictionary that ends right
+// before pos or -1 if there isn't one
+func findPDFDictStart(data string, pos int) int {
+	j := pos
+	for j > 0 && isWhitespace[data[j-1]] {
+		j--
+	}
+	if j < 2 || data[j-2:j] != ">>" {
+		return -1
+	}
+
+	// Walk back to the matching << taking nested dictionaries into account
+	depth := 0
+	for j >= 2 {
+		switch data[j-2 : j] {
+		case ">>":
+			depth++
+			j -= 2
+		case "<<":
+			depth--
+			j -= 2
+			if depth == 0 {
+				return j
+			}
+		default:
+			j--
+		}
+	}
+
+	return -1
+}
+
+// decodePDFStream applies the filters of a PDF stream and returns the text
+// shown by the text operators in it
+func decodePDFStream(encodedValue string, config decodeConfig) []decodedPart {
+	keyword := strings.LastIndex(encodedValue, "endstream")
+	streamStart := strings.Index(encodedValue, "stream")
+	if keyword < 0 || streamStart < 0 || streamStart >= keyword {
+		return nil
+	}
+	dict := encodedValue[:streamStart]
+
+	// Strip the end of line after stream and before endstream
+	content := encodedValue[streamStart+len("stream") : keyword]
+	content = strings.TrimPrefix(content, "\r")
+	content = strings.TrimPrefix(content, "\n")
+	content = strings.TrimSuffix(content, "\n")
+	content = strings.TrimSuffix(content, "\r")
+
+	decoded := []byte(content)
+	for _, filter := range pdfFilters(dict) {
+		var err error
+		switch filter {
+		case "FlateDecode", "Fl":
+			decoded, err = inflate(decoded)
+		case "ASCIIHexDecode", "AHx":
+			decoded, err = decodeASCIIHex(decoded)
+		case "ASCII85Decode", "A85":
+			decoded, err = decodeASCII85(decoded)
+		default:
+			// Image and other filters won't contain text
+			return nil
+		}
+		if err != nil {
+			return nil
+		}
+	}
+
+	text := extractPDFText(decoded, config.accept)
+	if len(text) == 0 {
+		return nil
+	}
+
+	return []decodedPart{{value: text}}
+}
+
+// pdfFilters returns the names of the filters in a stream dictionary in the
+// order they should be applied
+func pdfFilters(dict string) []string {
+	i := strings.Index(dict, "/Filter")
+	if i < 0 {
+		return nil
+	}
+	i += len("/Filter")
+	for i < len(dict) && isWhitespace[dict[i]] {
+		i++
+	}
+
+	array := i < len(dict) && dict[i] == '['
+	if array {
+		i++
+	}
+
+	filters := []string{}
+	for i < len(dict) {
+		c := dict[i]
+		switch {
+		case isWhitespace[c]:
+			i++
+		case c == '/':
+			name, end := readPDFToken(dict, i+1)
+			filters = append(filters, name)
+			i = end
+			if !array {
+				return filters
+			}
+		default:
+			return filters
+		}
+	}
+
+	return filters
+}
+
+// readPDFToken reads a regular token starting at i and returns it along with
+// the index after it
+func readPDFToken(data string, i int) (string, int) {
+	start := i
+	for i < len(data) && !isWhitespace[data[i]] && !isPDFDelimiter[data[i]] {
+		i++
+	}
+	return data[start:i], i
+}
+
+// decodeASCIIHex decodes ASCIIHexDecode data. Whitespace is ignored, a >
+// marks the end and a missing final digit is treated as 0.
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	decoded := make([]byte, 0, len(data)/2)
+	var high byte
+	odd := false
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if isWhitespace[c] {
+			continue
+		}
+		n := hexMap[c]
+		if n == '\xff' {
+			return nil, errInvalidPDFHex
+		}
+		if odd {
+			decoded = append(decoded, high<<4|n)
+		} else {
+			high = n
+		}
+		odd = !odd
+	}
+	if odd {
+		decoded = append(decoded, high<<4)
+	}
+
+	return decoded, nil
+}
+
+// decodeASCII85 decodes ASCII85Decode data which may be wrapped in <~ ~>
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+
+	decoded := make([]byte, 4*len(data))
+	n, _, err := ascii85.Decode(decoded, data, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded[:n], nil
+}
+
+// extractPDFText returns the strings shown by the text operators (Tj, TJ, '
+// and ") in a content stream that the policy accepts. Text objects and line
+// moves start new lines.
+func extractPDFText(content []byte, accept AcceptPolicy) string {
+	var text strings.Builder
+	operands := []string{}
+	lineHasText := false
+
+	newLine := func() {
+		if lineHasText {
+			text.WriteByte('\n')
+			lineHasText = false
+		}
+	}
+	show := func(s string) {
+		if len(s) > 0 && accept([]byte(s)) {
+			text.WriteString(s)
+			lineHasText = true
+		}
+	}
+
+	data := string(content)
+	i := 0
+	for i < len(data) {
+		c := data[i]
+		switch {
+		case isWhitespace[c]:
+			i++
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, end := readPDFLiteralString(data, i+1)
+			operands = append(operands, s)
+			i = end
+		case c == '<' && i+1 < len(data) && data[i+1] == '<',
+			c == '>' && i+1 < len(data) && data[i+1] == '>':
+			i += 2
+		case c == '<':
+			end := strings.IndexByte(data[i:], '>')
+			if end < 0 {
+				end = len(data) - i
+			}
+			if s, err := decodeASCIIHex([]byte(data[i+1 : i+end])); err == nil {
+				operands = append(operands, string(s))
+			}
+			i += end + 1
+		case c == '/':
+			_, i = readPDFToken(data, i+1) // names are operands
+		case isPDFDelimiter[c]:
+			i++
+		default:
+			var op string
+			op, i = readPDFToken(data, i)
+			if c == '.' || c == '-' || c == '+' || ('0' <= c && c <= '9') {
+				continue // numbers are operands
+			}
+
+			switch op {
+			case "Tj":
+				if len(operands) > 0 {
+					show(operands[len(operands)-1])
+				}
+			case "TJ":
+				for _, s := range operands {
+					show(s)
+				}
+			case "'", `"`:
+				newLine()
+				if len(operands) > 0 {
+					show(operands[len(operands)-1])
+				}
+			case "ET", "T*", "Td", "TD", "Tm":
+				newLine()
+			}
+			operands = operands[:0]
+		}
+	}
+
+	return strings.TrimSpace(text.String())
+}
+
+// readPDFLiteralString reads a literal string starting after its opening
+// parenthesis and returns it unescaped along with the index after it
+func readPDFLiteralString(data string, i int) (string, int) {
+	var s strings.Builder
+	depth := 1
+	for i < len(data) {
+		c := data[i]
+		i++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s.String(), i
+			}
+		case '\\':
+			if i >= len(data) {
+				continue
+			}
+			e := data[i]
+			i++
+			switch e {
+			case 'n':
+				s.WriteByte('\n')
+			case 'r':
+				s.WriteByte('\r')
+			case 't':
+				s.WriteByte('\t')
+			case 'b':
+				s.WriteByte('\b')
+			case 'f':
+				s.WriteByte('\f')
+			case '\r':
+				// Line continuation
+				if i < len(data) && data[i] == '\n' {
+					i++
+				}
+			case '\n':
+				// Line continuation
+			default:
+				if '0' <= e && e <= '7' {
+					// Up to three octal digits
+					b := e - '0'
+					for k := 0; k < 2 && i < len(data) && '0' <= data[i] && data[i] <= '7'; k++ {
+						b = b<<3 | (data[i] - '0')
+						i++
+					}
+					s.WriteByte(b)
+				} else {
+					s.WriteByte(e)
+				}
+			}
+			continue
+		}
+		s.WriteByte(c)
+	}
+
+	return s.String(), i
+}
@@ -1,11 +1,95 @@
 package codec
 
-// decodePercent decodes percent encoded strings
-func decodePercent(encodedValue string) string {
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// isFormTokenDelimiter is a lookup table of the characters that end a query
+// string or form body token
+var isFormTokenDelimiter [256]bool
+
+// isURLSafe is a lookup table of the unreserved and reserved URL characters
+// from RFC 3986 that are allowed between escapes in strict percent mode
+var isURLSafe [256]bool
+
+func init() {
+	for _, c := range " \t\n\r\f\v\"'`<>" {
+		isFormTokenDelimiter[c] = true
+	}
+	for c := '0'; c <= '9'; c++ {
+		isURLSafe[c] = true
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		isURLSafe[c] = true
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		isURLSafe[c] = true
+	}
+	for _, c := range "-._~:/?#[]@!$&'()*+,;=" {
+		isURLSafe[c] = true
+	}
+}
+
+// percentEscapeLen returns the length of the %XX or IIS style %uXXXX escape
+// at i or 0 if there isn't one
+func percentEscapeLen(data string, i int) int {
+	if data[i] != '%' {
+		return 0
+	}
+	if i+2 < len(data) && isHexChar[data[i+1]] && isHexChar[data[i+2]] {
+		return 3
+	}
+	if _, size := decodePercentU(data, i); size > 0 {
+		return 6
+	}
+
+	return 0
+}
+
+// findFormToken returns the token around the percent escape at i if it looks
+// like a query string or form body (e.g. a=1&b=2 or ?q=a+b). The token isn't
+// allowed to start before lowerBound.
+func findFormToken(data string, i, lowerBound int) (startEnd, bool) {
+	start := i
+	for start > lowerBound && !isFormTokenDelimiter[data[start-1]] {
+		start--
+	}
+	end := i
+	for end < len(data) && !isFormTokenDelimiter[data[end]] {
+		end++
+	}
+
+	token := data[start:end]
+	if !strings.Contains(token, "=") || !strings.ContainsAny(token, "&?") {
+		return startEnd{}, false
+	}
+
+	return startEnd{start, end}, true
+}
+
+// decodePercent decodes percent encoded strings. Only the bytes from the
+// escapes are checked against the policy since the rest was already there.
+func decodePercent(encodedValue string, config decodeConfig) []decodedPart {
+	return decodePercentEscapes(encodedValue, len(encodedValue), config)
+}
+
+// decodeForm decodes query strings and form bodies, which are percent
+// encoded with + for spaces. In a URL, only the + after the ? are spaces.
+func decodeForm(encodedValue string, config decodeConfig) []decodedPart {
+	return decodePercentEscapes(encodedValue, strings.IndexByte(encodedValue, '?')+1, config)
+}
+
+// decodePercentEscapes decodes %XX and %uXXXX escapes and turns + into spaces
+// from plusStart on
+func decodePercentEscapes(encodedValue string, plusStart int, config decodeConfig) []decodedPart {
 	encLen := len(encodedValue)
 	decodedValue := make([]byte, encLen)
+	escapedValue := make([]byte, 0, encLen/3)
 	decIndex := 0
 	encIndex := 0
+	wide := false
 
 	for encIndex < encLen {
 		if encodedValue[encIndex] == '%' && encIndex+2 < encLen {
@@ -14,15 +98,29 @@ func decodePercent(encodedValue string) string {
 			// Make sure they're hex characters
 			if n1|n2 != '\xff' {
 				b := n1<<4 | n2
-				if !printableASCII[b] {
-					return ""
-				}
-
+				escapedValue = append(escapedValue, b)
 				decodedValue[decIndex] = b
 				encIndex += 3
 				decIndex += 1
 				continue
 			}
+
+			// IIS style %uXXXX escapes
+			if r, size := decodePercentU(encodedValue, encIndex); size > 0 {
+				wide = true
+				runeLen := utf8.EncodeRune(decodedValue[decIndex:], r)
+				escapedValue = append(escapedValue, decodedValue[decIndex:decIndex+runeLen]...)
+				encIndex += size
+				decIndex += runeLen
+				continue
+			}
+		}
+
+		if encodedValue[encIndex] == '+' && encIndex >= plusStart {
+			decodedValue[decIndex] = ' '
+			encIndex += 1
+			decIndex += 1
+			continue
 		}
 
 		decodedValue[decIndex] = encodedValue[encIndex]
@@ -30,5 +128,38 @@ func decodePercent(encodedValue string) string {
 		decIndex += 1
 	}
 
-	return string(decodedValue[:decIndex])
+	if !config.accept(escapedValue) {
+		// Old web apps escape Windows-1252 and Latin-1 bytes. The
+		// literal characters are ASCII in those, so the whole value is
+		// transcoded unless %u escapes already made it UTF-8.
+		if !wide {
+			return transcodeBytes(decodedValue[:decIndex], config)
+		}
+		return nil
+	}
+
+	return []decodedPart{{value: string(decodedValue[:decIndex])}}
+}
+
+// decodePercentU decodes the %uXXXX escape at i using parseHex4, combining
+// UTF-16 surrogate pairs. It returns the rune and how many characters were
+// used, or a size of 0 if there isn't an escape at i.
+func decodePercentU(s string, i int) (rune, int) {
+	if i+5 >= len(s) || s[i] != '%' || (s[i+1] != 'u' && s[i+1] != 'U') {
+		return 0, 0
+	}
+	r, ok := parseHex4(s, i+2)
+	if !ok {
+		return 0, 0
+	}
+
+	if utf16.IsSurrogate(r) && i+11 < len(s) && s[i+6] == '%' && (s[i+7] == 'u' || s[i+7] == 'U') {
+		if r2, ok := parseHex4(s, i+8); ok {
+			if combined := utf16.DecodeRune(r, r2); combined != utf8.RuneError {
+				return combined, 12
+			}
+		}
+	}
+
+	return r, 6
 }
@@ -0,0 +1,537 @@
+package codec
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// PGP armor lines
+const (
+	pgpArmorBegin = "-----BEGIN PGP "
+	pgpArmorEnd   = "-----END PGP "
+	pgpArmorDash  = "-----"
+)
+
+// maxPGPPackets limits how many packets are summarized
+const maxPGPPackets = 1024
+
+// pgpPacketNames are the names of the packet types by tag
+var pgpPacketNames = map[int]string{
+	1:  "public-key-encrypted-session-key",
+	2:  "signature",
+	3:  "symmetric-key-encrypted-session-key",
+	4:  "one-pass-signature",
+	5:  "secret-key",
+	6:  "public-key",
+	7:  "secret-subkey",
+	8:  "compressed-data",
+	9:  "symmetrically-encrypted-data",
+	10: "marker",
+	11: "literal-data",
+	12: "trust",
+	13: "user-id",
+	14: "public-subkey",
+	17: "user-attribute",
+	18: "encrypted-integrity-protected-data",
+	19: "modification-detection-code",
+	20: "aead-encrypted-data",
+	21: "padding",
+}
+
+// pgpAlgorithmNames are the names of the public key algorithms by ID
+var pgpAlgorithmNames = map[byte]string{
+	1:  "rsa",
+	2:  "rsa",
+	3:  "rsa",
+	16: "elgamal",
+	17: "dsa",
+	18: "ecdh",
+	19: "ecdsa",
+	22: "eddsa",
+	25: "x25519",
+	26: "x448",
+	27: "ed25519",
+	28: "ed448",
+}
+
+// pgpMPICounts is how many MPIs make up the public key material of the
+// algorithms that are only MPIs
+var pgpMPICounts = map[byte]int{
+	1:  2, // n, e
+	2:  2,
+	3:  2,
+	16: 3, // p, g, y
+	17: 4, // p, q, g, y
+}
+
+// pgpKeySizes is the size of the public key material of the algorithms that
+// use fixed size keys
+var pgpKeySizes = map[byte]int{
+	25: 32,
+	26: 56,
+	27: 32,
+	28: 57,
+}
+
+// findPGPArmor matches ASCII armored PGP blocks from the BEGIN line through
+// the END line with the same type
+func findPGPArmor(data string) []startEnd {
+	var matches []startEnd
+	for i := 0; i < len(data); {
+		start := strings.Index(data[i:], pgpArmorBegin)
+		if start < 0 {
+			break
+		}
+		start += i
+
+		typeStart := start + len(pgpArmorBegin)
+		typeEnd := strings.Index(data[typeStart:], pgpArmorDash)
+		if typeEnd < 0 || strings.ContainsAny(data[typeStart:typeStart+typeEnd], "\r\n") {
+			i = typeStart
+			continue
+		}
+		typeEnd += typeStart
+
+		endLine := pgpArmorEnd + data[typeStart:typeEnd] + pgpArmorDash
+		end := strings.Index(data[typeEnd:], endLine)
+		if end < 0 {
+			i = typeEnd
+			continue
+		}
+		end += typeEnd + len(endLine)
+
+		matches = append(matches, startEnd{start, end})
+		i = end
+	}
+
+	return matches
+}
+
+// decodePGPArmor checks the CRC24 of an armored block and summarizes its
+// packets. The summary lists the packet types along with the key IDs and
+// algorithms of keys, the issuers of signatures, the user IDs, and whether
+// secret keys are encrypted. It's tagged with the block type and, for
+// secret keys, whether any of them are unencrypted.
+func decodePGPArmor(encodedValue string, config decodeConfig) []decodedPart {
+	blockType, packets, ok := readPGPArmor(encodedValue)
+	if !ok {
+		return nil
+	}
+
+	var summary strings.Builder
+	summary.WriteString("PGP " + blockType)
+	tags := []string{"pgp-block:" + strings.ToLower(strings.ReplaceAll(strings.TrimSuffix(blockType, " BLOCK"), " ", "-"))}
+	secretKeys := ""
+	for i := 0; i < maxPGPPackets && len(packets) > 0; i++ {
+		tag, body, rest, ok := readPGPPacket(packets)
+		if !ok {
+			break
+		}
+		packets = rest
+
+		name, ok := pgpPacketNames[tag]
+		if !ok {
+			name = fmt.Sprintf("packet-%d", tag)
+		}
+		summary.WriteString("\n" + name)
+
+		switch tag {
+		case 5, 6, 7, 14:
+			details, s2kUsage := pgpKeyDetails(body)
+			summary.WriteString(details)
+			switch {
+			case tag == 6 || tag == 14:
+				// Public keys don't have an S2K usage
+			case s2kUsage == 0:
+				summary.WriteString(" unencrypted")
+				secretKeys = "unencrypted"
+			case s2kUsage > 0:
+				summary.WriteString(" encrypted")
+				if secretKeys == "" {
+					secretKeys = "encrypted"
+				}
+			}
+		case 2:
+			if issuer := pgpSignatureIssuer(body); issuer != "" {
+				summary.WriteString(" issuer " + issuer)
+			}
+		case 1:
+			if len(body) >= 9 && body[0] == 3 {
+				summary.WriteString(" key-id " + strings.ToUpper(hex.EncodeToString(body[1:9])))
+			}
+		case 13:
+			summary.WriteString(" " + string(body))
+		}
+	}
+	if secretKeys != "" {
+		tags = append(tags, "pgp-secret-key:"+secretKeys)
+	}
+
+	value := summary.String()
+	if !config.accept([]byte(value)) {
+		return nil
+	}
+
+	return []decodedPart{{value: value, tags: tags}}
+}
+
+// readPGPArmor returns the block type and the packets of an armored block.
+// The armor headers are skipped and the CRC24 is checked if there is one.
+func readPGPArmor(armor string) (string, []byte, bool) {
+	lines := strings.Split(armor, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	if len(lines) < 2 {
+		return "", nil, false
+	}
+	blockType := strings.TrimSuffix(strings.TrimPrefix(lines[0], pgpArmorBegin), pgpArmorDash)
+
+	// Armor headers like Version: and Comment: come before the data
+	i := 1
+	for i < len(lines) && strings.Contains(lines[i], ": ") {
+		i++
+	}
+
+	var body strings.Builder
+	checksum := ""
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, pgpArmorEnd) {
+			break
+		}
+		if strings.HasPrefix(line, "=") && len(line) == 5 {
+			checksum = line[1:]
+			break
+		}
+		body.WriteString(line)
+	}
+
+	packets, err := base64.StdEncoding.DecodeString(body.String())
+	if err != nil || len(packets) == 0 {
+		return "", nil, false
+	}
+
+	if checksum != "" {
+		crc, err := base64.StdEncoding.DecodeString(checksum)
+		if err != nil || len(crc) != 3 || uint32(crc[0])<<16|uint32(crc[1])<<8|uint32(crc[2]) != crc24(packets) {
+			return "", nil, false
+		}
+	}
+
+	return blockType, packets, true
+}
+
+// crc24 is the checksum used by PGP armor
+func crc24(data []byte) uint32 {
+	crc := uint32(0xb704ce)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+
+	return crc & 0xffffff
+}
+
+// readPGPPacket reads the packet at the start of data and returns its tag,
+// its body and the data after it. Partial body lengths are joined.
+func readPGPPacket(data []byte) (int, []byte, []byte, bool) {
+	if len(data) == 0 || data[0]&0x80 == 0 {
+		return 0, nil, nil, false
+	}
+
+	header := data[0]
+	data = data[1:]
+
+	// Old format packets
+	if header&0x40 == 0 {
+		tag := int(header>>2) & 0x0f
+		var length int
+		switch header & 0x03 {
+		case 0:
+			if len(data) < 1 {
+				return 0, nil, nil, false
+			}
+			length, data = int(data[0]), data[1:]
+		case 1:
+			if len(data) < 2 {
+				return 0, nil, nil, false
+			}
+			length, data = int(binary.BigEndian.Uint16(data)), data[2:]
+		case 2:
+			if len(data) < 4 {
+				return 0, nil, nil, false
+			}
+			length, data = int(binary.BigEndian.Uint32(data)), data[4:]
+		default:
+			length = len(data) // indeterminate
+		}
+		if length < 0 || length > len(data) {
+			return 0, nil, nil, false
+		}
+		return tag, data[:length], data[length:], true
+	}
+
+	// New format packets
+	tag := int(header & 0x3f)
+	var body []byte
+	for {
+		if len(data) < 1 {
+			return 0, nil, nil, false
+		}
+
+		partial := false
+		var length int
+		switch first := int(data[0]); {
+		case first < 192:
+			length, data = first, data[1:]
+		case first < 224:
+			if len(data) < 2 {
+				return 0, nil, nil, false
+			}
+			length, data = (first-192)<<8+int(data[1])+192, data[2:]
+		case first == 255:
+			if len(data) < 5 {
+				return 0, nil, nil, false
+			}
+			length, data = int(binary.BigEndian.Uint32(data[1:])), data[5:]
+		default:
+			length, data = 1<<(first&0x1f), data[1:]
+			partial = true
+		}
+		if length < 0 || length > len(data) {
+			return 0, nil, nil, false
+		}
+
+		body = append(body, data[:length]...)
+		data = data[length:]
+		if !partial {
+			return tag, body, data, true
+		}
+	}
+}
+
+// pgpKeyDetails returns the version, algorithm and key ID of a key packet
+// along with the S2K usage that follows the public key material in secret
+// keys. The S2K usage is -1 when there isn't one.
+func pgpKeyDetails(body []byte) (string, int) {
+	if len(body) < 1 {
+		return "", -1
+	}
+
+	version := body[0]
+	details := fmt.Sprintf(" v%d", version)
+	var algorithm byte
+	var keyID []byte
+	publicEnd := -1
+
+	switch version {
+	case 3:
+		// The key ID is the low 64 bits of the RSA modulus
+		if len(body) < 8 {
+			return details, -1
+		}
+		algorithm = body[7]
+		if n, end, ok := readPGPMPI(body, 8); ok && len(n) >= 8 {
+			keyID = n[len(n)-8:]
+			if _, end, ok = readPGPMPI(body, end); ok {
+				publicEnd = end
+			}
+		}
+	case 4:
+		if len(body) < 6 {
+			return details, -1
+		}
+		algorithm = body[5]
+		publicEnd = pgpPublicKeyEnd(algorithm, body, 6)
+		if publicEnd > 0 {
+			hash := sha1.New()
+			hash.Write([]byte{0x99, byte(publicEnd >> 8), byte(publicEnd)})
+			hash.Write(body[:publicEnd])
+			keyID = hash.Sum(nil)[12:]
+		}
+	case 5, 6:
+		if len(body) < 10 {
+			return details, -1
+		}
+		algorithm = body[5]
+		publicEnd = 10 + int(binary.BigEndian.Uint32(body[6:]))
+		if publicEnd > len(body) || publicEnd < 10 {
+			publicEnd = -1
+			break
+		}
+		hash := sha256.New()
+		hash.Write([]byte{0x95 + version, byte(publicEnd >> 24), byte(publicEnd >> 16), byte(publicEnd >> 8), byte(publicEnd)})
+		hash.Write(body[:publicEnd])
+		keyID = hash.Sum(nil)[:8]
+	default:
+		return details, -1
+	}
+
+	if name, ok := pgpAlgorithmNames[algorithm]; ok {
+		details += " " + name
+	} else {
+		details += fmt.Sprintf(" algorithm-%d", algorithm)
+	}
+	if keyID != nil {
+		details += " key-id " + strings.ToUpper(hex.EncodeToString(keyID))
+	}
+
+	// Secret keys have the S2K usage right after the public key material
+	if publicEnd < 0 || publicEnd >= len(body) {
+		return details, -1
+	}
+
+	return details, int(body[publicEnd])
+}
+
+// pgpPublicKeyEnd returns where the public key material of a v4 key that
+// starts at i ends, or -1 if it can't be read
+func pgpPublicKeyEnd(algorithm byte, body []byte, i int) int {
+	if count, ok := pgpMPICounts[algorithm]; ok {
+		for j := 0; j < count; j++ {
+			var ok bool
+			if _, i, ok = readPGPMPI(body, i); !ok {
+				return -1
+			}
+		}
+		return i
+	}
+	if size, ok := pgpKeySizes[algorithm]; ok {
+		if i+size > len(body) {
+			return -1
+		}
+		return i + size
+	}
+
+	switch algorithm {
+	case 18, 19, 22:
+		// Curve OID and point, plus KDF parameters for ECDH
+		if i >= len(body) || i+1+int(body[i]) > len(body) {
+			return -1
+		}
+		i += 1 + int(body[i])
+		var ok bool
+		if _, i, ok = readPGPMPI(body, i); !ok {
+			return -1
+		}
+		if algorithm == 18 {
+			if i >= len(body) || i+1+int(body[i]) > len(body) {
+				return -1
+			}
+			i += 1 + int(body[i])
+		}
+		return i
+	}
+
+	return -1
+}
+
+// readPGPMPI reads the multiprecision integer at i and returns its bytes
+// and where it ends
+func readPGPMPI(body []byte, i int) ([]byte, int, bool) {
+	if i+2 > len(body) {
+		return nil, 0, false
+	}
+	size := (int(binary.BigEndian.Uint16(body[i:])) + 7) / 8
+	i += 2
+	if i+size > len(body) {
+		return nil, 0, false
+	}
+
+	return body[i : i+size], i + size, true
+}
+
+// pgpSignatureIssuer returns the key ID of the key that made a signature
+func pgpSignatureIssuer(body []byte) string {
+	if len(body) < 1 {
+		return ""
+	}
+
+	switch body[0] {
+	case 2, 3:
+		if len(body) < 15 {
+			return ""
+		}
+		return strings.ToUpper(hex.EncodeToString(body[7:15]))
+	case 4, 5, 6:
+		// The issuer is in the hashed or unhashed subpackets
+		i := 4
+		lengthSize := 2
+		if body[0] == 6 {
+			lengthSize = 4
+		}
+		for area := 0; area < 2; area++ {
+			if i+lengthSize > len(body) {
+				return ""
+			}
+			length := int(binary.BigEndian.Uint16(body[i:]))
+			if lengthSize == 4 {
+				length = int(binary.BigEndian.Uint32(body[i:]))
+			}
+			i += lengthSize
+			if length < 0 || i+length > len(body) {
+				return ""
+			}
+			if issuer := pgpSubpacketIssuer(body[i : i+length]); issuer != "" {
+				return issuer
+			}
+			i += length
+		}
+	}
+
+	return ""
+}
+
+// pgpSubpacketIssuer returns the key ID from an issuer or issuer fingerprint
+// subpacket
+func pgpSubpacketIssuer(subpackets []byte) string {
+	for len(subpackets) > 0 {
+		var length int
+		switch first := int(subpackets[0]); {
+		case first < 192:
+			length, subpackets = first, subpackets[1:]
+		case first < 255:
+			if len(subpackets) < 2 {
+				return ""
+			}
+			length, subpackets = (first-192)<<8+int(subpackets[1])+192, subpackets[2:]
+		default:
+			if len(subpackets) < 5 {
+				return ""
+			}
+			length, subpackets = int(binary.BigEndian.Uint32(subpackets[1:])), subpackets[5:]
+		}
+		if length < 1 || length > len(subpackets) {
+			return ""
+		}
+
+		data := subpackets[1:length]
+		switch subpackets[0] & 0x7f {
+		case 16: // issuer key ID
+			if len(data) == 8 {
+				return strings.ToUpper(hex.EncodeToString(data))
+			}
+		case 33: // issuer fingerprint
+			switch {
+			case len(data) == 21 && data[0] == 4:
+				return strings.ToUpper(hex.EncodeToString(data[13:]))
+			case len(data) == 33:
+				return strings.ToUpper(hex.EncodeToString(data[1:9]))
+			}
+		}
+		subpackets = subpackets[length:]
+	}
+
+	return ""
+}
@@ -0,0 +1,75 @@
+package codec
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// AcceptPolicy decides whether the bytes produced by decoding a value are
+// worth keeping. Values that aren't accepted are left encoded.
+type AcceptPolicy func(decoded []byte) bool
+
+// StrictASCII only accepts printable ASCII. This is the default policy.
+func StrictASCII(decoded []byte) bool {
+	return isPrintableASCII(decoded)
+}
+
+// PrintableUTF8 accepts valid UTF-8 that has no control characters other
+// than whitespace
+func PrintableUTF8(decoded []byte) bool {
+	for i := 0; i < len(decoded); {
+		r, size := utf8.DecodeRune(decoded[i:])
+		if !isPrintableRune(r, size) {
+			return false
+		}
+		i += size
+	}
+
+	return true
+}
+
+// PrintableRatio returns a policy that accepts values where at least the
+// given fraction (0 to 1) of the bytes are part of printable characters.
+// Invalid UTF-8 counts as unprintable.
+func PrintableRatio(threshold float64) AcceptPolicy {
+	return func(decoded []byte) bool {
+		if len(decoded) == 0 {
+			return false
+		}
+
+		printable := 0
+		for i := 0; i < len(decoded); {
+			r, size := utf8.DecodeRune(decoded[i:])
+			if isPrintableRune(r, size) {
+				printable += size
+			}
+			i += size
+		}
+
+		return float64(printable)/float64(len(decoded)) >= threshold
+	}
+}
+
+// isPrintableRune returns true if a decoded rune is valid and printable
+func isPrintableRune(r rune, size int) bool {
+	if r == utf8.RuneError && size <= 1 {
+		return false
+	}
+	if r < utf8.RuneSelf {
+		return printableASCII[r]
+	}
+
+	return !unicode.IsControl(r)
+}
+
+// policy returns the accept policy that applies to an encoding
+func (d *Decoder) policy(e *encoding) AcceptPolicy {
+	if accept, ok := d.EncodingPolicies[e.kind.String()]; ok && accept != nil {
+		return accept
+	}
+	if d.Policy != nil {
+		return d.Policy
+	}
+
+	return StrictASCII
+}
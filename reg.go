@@ -0,0 +1,164 @@
+package codec
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// Registry value types whose hex data is UTF-16LE text
+const (
+	regSZ       = "1"
+	regExpandSZ = "2"
+	regMultiSZ  = "7"
+)
+
+// regValue is a hex value from a .reg export
+type regValue struct {
+	// name is the unescaped value name, or @ for the default value
+	name string
+	// valueType is the hex digits in hex(...) or empty for hex:
+	valueType string
+	// data is the span of the comma separated bytes
+	data startEnd
+}
+
+// findRegValues matches the "Name"=hex:... values of .reg exports from the
+// name through the last byte, including the lines they continue onto
+func findRegValues(data string) []startEnd {
+	var matches []startEnd
+	for i := 0; i < len(data); i = nextLineEnd(data, i) + 1 {
+		if data[i] != '"' && data[i] != '@' {
+			continue
+		}
+
+		if value, ok := parseRegValue(data[i:]); ok {
+			matches = append(matches, startEnd{i, i + value.data.end})
+			i += value.data.end
+		}
+	}
+
+	return matches
+}
+
+// parseRegValue parses the name, type and data of a hex value at the start
+// of s
+func parseRegValue(s string) (regValue, bool) {
+	var value regValue
+	i := 1
+	if s[0] == '@' {
+		value.name = "@"
+	} else {
+		var name strings.Builder
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\n' {
+				return value, false
+			}
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+			name.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return value, false
+		}
+		value.name = name.String()
+		i++
+	}
+
+	if !strings.HasPrefix(s[i:], "=hex") {
+		return value, false
+	}
+	i += len("=hex")
+	if i < len(s) && s[i] == '(' {
+		typeEnd := strings.IndexByte(s[i:], ')')
+		if typeEnd < 2 || hasByte(s[i+1:i+typeEnd], isNotHexChar[:]) {
+			return value, false
+		}
+		value.valueType = strings.ToLower(strings.TrimLeft(s[i+1:i+typeEnd], "0"))
+		i += typeEnd + 1
+	}
+	if i == len(s) || s[i] != ':' {
+		return value, false
+	}
+	i++
+
+	// Read the bytes, following the \ at the end of lines onto the next
+	value.data = startEnd{i, i}
+	for i+1 < len(s) && isHexChar[s[i]] && isHexChar[s[i+1]] {
+		i += 2
+		value.data.end = i
+		if i == len(s) || s[i] != ',' {
+			break
+		}
+		i++
+		if strings.HasPrefix(s[i:], "\\\r\n") {
+			i += 3
+		} else if strings.HasPrefix(s[i:], "\\\n") {
+			i += 2
+		}
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+	}
+
+	return value, value.data.end > value.data.start
+}
+
+// decodeRegValue decodes the bytes of a hex value. String types are decoded
+// from UTF-16LE and the strings of REG_MULTI_SZ values are put on their own
+// lines.
+func decodeRegValue(encodedValue string, config decodeConfig) []decodedPart {
+	value, ok := parseRegValue(encodedValue)
+	if !ok {
+		return nil
+	}
+
+	digits := encodedValue[value.data.start:value.data.end]
+	decoded := make([]byte, 0, len(digits)/3+1)
+	for i := 0; i+1 < len(digits); i++ {
+		if isHexChar[digits[i]] && isHexChar[digits[i+1]] {
+			decoded = append(decoded, hexMap[digits[i]]<<4|hexMap[digits[i+1]])
+			i++
+		}
+	}
+
+	var parts []decodedPart
+	switch value.valueType {
+	case regSZ, regExpandSZ, regMultiSZ:
+		text, ok := decodeUTF16LE(decoded)
+		if !ok {
+			return nil
+		}
+		text = strings.TrimRight(text, "\x00")
+		if value.valueType == regMultiSZ {
+			text = strings.ReplaceAll(text, "\x00", "\n")
+		}
+		if len(text) == 0 || !config.accept([]byte(text)) {
+			return nil
+		}
+		parts = []decodedPart{{value: text}}
+	default:
+		parts = decodeBytes(decoded, config)
+	}
+
+	for i := range parts {
+		parts[i].span = value.data
+		parts[i].tags = append([]string{"reg-value:" + value.name}, parts[i].tags...)
+	}
+
+	return parts
+}
+
+// decodeUTF16LE decodes UTF-16LE text
+func decodeUTF16LE(b []byte) (string, bool) {
+	if len(b)%2 != 0 {
+		return "", false
+	}
+
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i]) | uint16(b[2*i+1])<<8
+	}
+
+	return string(utf16.Decode(units)), true
+}
@@ -2,6 +2,7 @@ package codec
 
 import (
 	"fmt"
+	"slices"
 )
 
 // EncodedSegment represents a portion of text that is encoded in some way.
@@ -23,12 +24,23 @@ type EncodedSegment struct {
 	// decodedValue contains the decoded string for this segment
 	decodedValue string
 
-	// encodings is the encodings that make up this segment. encodingKind
-	// can be or'd together to hold multiple encodings
-	encodings encodingKind
+	// encodings is the set of encodings that make up this segment
+	encodings kindSet
+
+	// tags are extra meta data tags about this segment (e.g. the archive
+	// entry it came from)
+	tags []string
+
+	// offsets maps each byte of the decoded value to its offset in the
+	// encoded value when the decoder kept track of it
+	offsets []int
 
 	// depth is how many decoding passes it took to decode this segment
 	depth int
+
+	// opaque is true if the segment was tagged without being decoded (e.g.
+	// an encrypted blob)
+	opaque bool
 }
 
 // Tags returns additional meta data tags related to the types of segments
@@ -42,23 +54,37 @@ func Tags(segments []*EncodedSegment) []string {
 	// should be the same
 	depth := segments[0].depth
 
-	// Collect the encodings from the segments
-	encodings := segments[0].encodings
+	// Collect the encodings and extra tags from the segments
+	encodings := kindSet(nil).union(segments[0].encodings)
+	extraTags := appendUnique(nil, segments[0].tags...)
 	for i := 1; i < len(segments); i++ {
-		encodings |= segments[i].encodings
+		encodings = encodings.union(segments[i].encodings)
+		extraTags = appendUnique(extraTags, segments[i].tags...)
 	}
 
 	kinds := encodings.kinds()
-	tags := make([]string, len(kinds)+1)
+	tags := make([]string, 0, len(kinds)+len(extraTags)+1)
 
-	tags[len(tags)-1] = fmt.Sprintf("decode-depth:%d", depth)
-	for i, kind := range kinds {
-		tags[i] = fmt.Sprintf("decoded:%s", kind)
+	for _, kind := range kinds {
+		tags = append(tags, fmt.Sprintf("decoded:%s", kind))
 	}
+	tags = append(tags, extraTags...)
+	tags = append(tags, fmt.Sprintf("decode-depth:%d", depth))
 
 	return tags
 }
 
+// appendUnique appends the values to the slice if they aren't already in it
+func appendUnique(slice []string, values ...string) []string {
+	for _, value := range values {
+		if !slices.Contains(slice, value) {
+			slice = append(slice, value)
+		}
+	}
+
+	return slice
+}
+
 // CurrentLine returns from the start of the line containing the segments
 // to the end of the line where the segment ends.
 func CurrentLine(segments []*EncodedSegment, currentRaw string) string {
@@ -148,16 +174,20 @@ func toOriginal(predecessors []*EncodedSegment, decoded startEnd) startEnd {
 			continue // Not in scope
 		}
 
-		// If fully contained, return the segments original start/end
+		// If fully contained, return the segments original start/end, or
+		// the exact characters when there's an offset map
 		if p.decoded.contains(decoded) {
+			if p.offsets != nil {
+				return toOriginal(p.predecessors, p.toEncoded(decoded))
+			}
 			return p.original
 		}
 
 		// Map the value to be relative to the predecessors's decoded values
 		if encoded.end == 0 {
-			encoded = p.encoded.add(p.decoded.overflow(decoded))
+			encoded = p.toEncoded(decoded)
 		} else {
-			encoded = encoded.merge(p.encoded.add(p.decoded.overflow(decoded)))
+			encoded = encoded.merge(p.toEncoded(decoded))
 		}
 	}
 
@@ -171,3 +201,31 @@ func toOriginal(predecessors []*EncodedSegment, decoded startEnd) startEnd {
 	// (NOTE: each segment references all the predecessors)
 	return toOriginal(predecessors[0].predecessors, encoded)
 }
+
+// toEncoded maps a start/end that overlaps the segment's decoded value to
+// the encoded value. The parts outside of the decoded value carry over as
+// is. Without an offset map the decoded value maps to the whole encoded
+// value.
+func (s *EncodedSegment) toEncoded(decoded startEnd) startEnd {
+	if s.offsets == nil {
+		return s.encoded.add(s.decoded.overflow(decoded))
+	}
+
+	return startEnd{
+		s.encoded.start + s.encodedOffset(decoded.start-s.decoded.start),
+		s.encoded.start + s.encodedOffset(decoded.end-s.decoded.start),
+	}
+}
+
+// encodedOffset maps an offset relative to the start of the decoded value
+// to one relative to the start of the encoded value
+func (s *EncodedSegment) encodedOffset(i int) int {
+	switch {
+	case i < 0:
+		return i
+	case i >= len(s.offsets):
+		return s.encoded.end - s.encoded.start + i - (len(s.offsets) - 1)
+	default:
+		return s.offsets[i]
+	}
+}
@@ -27,6 +27,15 @@ func (s startEnd) add(o startEnd) startEnd {
 	}
 }
 
+// narrow returns the part of this one covered by o, where o is relative to
+// the start of this one
+func (s startEnd) narrow(o startEnd) startEnd {
+	return startEnd{
+		s.start + o.start,
+		s.start + o.end,
+	}
+}
+
 // overlaps returns true if two startEnds overlap
 func (s startEnd) overlaps(o startEnd) bool {
 	return o.start <= s.end && o.end >= s.start